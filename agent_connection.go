@@ -8,7 +8,8 @@ import (
 
 // AgentSideConnection 为代理提供 Client 接口。
 type AgentSideConnection struct {
-	rpc *rpcConnection
+	rpc     *rpcConnection
+	handler *agentInboundHandler
 }
 
 // NewAgentSideConnection 创建代理侧连接。
@@ -17,11 +18,32 @@ func NewAgentSideConnection(
 	agent Agent,
 	outgoing io.Writer,
 	incoming io.Reader,
+	opts ...ConnectionOption,
 ) *AgentSideConnection {
-	handler := &agentInboundHandler{agent: agent}
-	return &AgentSideConnection{
-		rpc: newRPCConnection(ctx, handler, outgoing, incoming),
-	}
+	options := newConnectionOptions(opts)
+	handler := &agentInboundHandler{agent: agent, opts: options, idle: newIdleTracker(options)}
+	conn := &AgentSideConnection{
+		rpc:     newRPCConnection(ctx, handler, outgoing, incoming, options),
+		handler: handler,
+	}
+	conn.rpc.peer = conn
+	conn.rpc.start(ctx)
+	return conn
+}
+
+// State 返回连接当前的生命周期状态。
+func (a *AgentSideConnection) State() ConnectionState {
+	return a.handler.lifecycle.State()
+}
+
+// PeerCapabilities 返回客户端在 initialize 中声明的能力，第二个返回值表示是否已完成初始化。
+func (a *AgentSideConnection) PeerCapabilities() (ClientCapabilities, bool) {
+	return a.handler.peerCapabilities()
+}
+
+func (a *AgentSideConnection) requireCapability(method string) error {
+	caps, initialized := a.handler.peerCapabilities()
+	return requireClientCapability(caps, initialized, method)
 }
 
 // Close 关闭连接。
@@ -50,6 +72,9 @@ func (a *AgentSideConnection) RequestPermission(ctx context.Context, req Request
 // WriteTextFile 调用 fs/write_text_file。
 func (a *AgentSideConnection) WriteTextFile(ctx context.Context, req WriteTextFileRequest) (WriteTextFileResponse, error) {
 	var resp WriteTextFileResponse
+	if err := a.requireCapability(ClientMethods.FSWriteTextFile); err != nil {
+		return resp, err
+	}
 	raw, err := a.rpc.request(ctx, ClientMethods.FSWriteTextFile, req)
 	if err != nil {
 		return resp, err
@@ -66,6 +91,9 @@ func (a *AgentSideConnection) WriteTextFile(ctx context.Context, req WriteTextFi
 // ReadTextFile 调用 fs/read_text_file。
 func (a *AgentSideConnection) ReadTextFile(ctx context.Context, req ReadTextFileRequest) (ReadTextFileResponse, error) {
 	var resp ReadTextFileResponse
+	if err := a.requireCapability(ClientMethods.FSReadTextFile); err != nil {
+		return resp, err
+	}
 	raw, err := a.rpc.request(ctx, ClientMethods.FSReadTextFile, req)
 	if err != nil {
 		return resp, err
@@ -79,6 +107,9 @@ func (a *AgentSideConnection) ReadTextFile(ctx context.Context, req ReadTextFile
 // CreateTerminal 调用 terminal/create。
 func (a *AgentSideConnection) CreateTerminal(ctx context.Context, req CreateTerminalRequest) (CreateTerminalResponse, error) {
 	var resp CreateTerminalResponse
+	if err := a.requireCapability(ClientMethods.TerminalCreate); err != nil {
+		return resp, err
+	}
 	raw, err := a.rpc.request(ctx, ClientMethods.TerminalCreate, req)
 	if err != nil {
 		return resp, err
@@ -92,6 +123,9 @@ func (a *AgentSideConnection) CreateTerminal(ctx context.Context, req CreateTerm
 // TerminalOutput 调用 terminal/output。
 func (a *AgentSideConnection) TerminalOutput(ctx context.Context, req TerminalOutputRequest) (TerminalOutputResponse, error) {
 	var resp TerminalOutputResponse
+	if err := a.requireCapability(ClientMethods.TerminalOutput); err != nil {
+		return resp, err
+	}
 	raw, err := a.rpc.request(ctx, ClientMethods.TerminalOutput, req)
 	if err != nil {
 		return resp, err
@@ -105,6 +139,9 @@ func (a *AgentSideConnection) TerminalOutput(ctx context.Context, req TerminalOu
 // ReleaseTerminal 调用 terminal/release。
 func (a *AgentSideConnection) ReleaseTerminal(ctx context.Context, req ReleaseTerminalRequest) (ReleaseTerminalResponse, error) {
 	var resp ReleaseTerminalResponse
+	if err := a.requireCapability(ClientMethods.TerminalRelease); err != nil {
+		return resp, err
+	}
 	raw, err := a.rpc.request(ctx, ClientMethods.TerminalRelease, req)
 	if err != nil {
 		return resp, err
@@ -121,6 +158,9 @@ func (a *AgentSideConnection) ReleaseTerminal(ctx context.Context, req ReleaseTe
 // WaitForTerminalExit 调用 terminal/wait_for_exit。
 func (a *AgentSideConnection) WaitForTerminalExit(ctx context.Context, req WaitForTerminalExitRequest) (WaitForTerminalExitResponse, error) {
 	var resp WaitForTerminalExitResponse
+	if err := a.requireCapability(ClientMethods.TerminalWaitForExit); err != nil {
+		return resp, err
+	}
 	raw, err := a.rpc.request(ctx, ClientMethods.TerminalWaitForExit, req)
 	if err != nil {
 		return resp, err
@@ -134,6 +174,9 @@ func (a *AgentSideConnection) WaitForTerminalExit(ctx context.Context, req WaitF
 // KillTerminalCommand 调用 terminal/kill。
 func (a *AgentSideConnection) KillTerminalCommand(ctx context.Context, req KillTerminalCommandRequest) (KillTerminalCommandResponse, error) {
 	var resp KillTerminalCommandResponse
+	if err := a.requireCapability(ClientMethods.TerminalKill); err != nil {
+		return resp, err
+	}
 	raw, err := a.rpc.request(ctx, ClientMethods.TerminalKill, req)
 	if err != nil {
 		return resp, err
@@ -152,10 +195,10 @@ func (a *AgentSideConnection) SessionNotification(ctx context.Context, note Sess
 	return a.rpc.notify(ctx, ClientMethods.SessionUpdate, note)
 }
 
-// ExtMethod 调用扩展方法。
+// ExtMethod 调用扩展方法，params 原样作为 _method 的参数发送。
 func (a *AgentSideConnection) ExtMethod(ctx context.Context, method string, params json.RawMessage) (ExtResponse, error) {
 	var resp ExtResponse
-	raw, err := a.rpc.request(ctx, "_"+method, ExtRequest{Method: method, Params: params})
+	raw, err := a.rpc.request(ctx, "_"+method, params)
 	if err != nil {
 		return resp, err
 	}
@@ -163,7 +206,7 @@ func (a *AgentSideConnection) ExtMethod(ctx context.Context, method string, para
 	return resp, nil
 }
 
-// ExtNotification 发送扩展通知。
+// ExtNotification 发送扩展通知，params 原样作为 _method 的参数发送。
 func (a *AgentSideConnection) ExtNotification(ctx context.Context, method string, params json.RawMessage) error {
-	return a.rpc.notify(ctx, "_"+method, ExtNotification{Method: method, Params: params})
+	return a.rpc.notify(ctx, "_"+method, params)
 }
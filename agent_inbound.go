@@ -4,123 +4,216 @@ import (
 	"context"
 	"encoding/json"
 	"strings"
+	"sync"
 )
 
 type agentInboundHandler struct {
 	agent Agent
+	opts  connectionOptions
+
+	routerOnce sync.Once
+	router     *Router
+	lifecycle  connectionLifecycle
+	turns      turnTracker
+	idle       *idleTracker
+
+	mu                 sync.Mutex
+	agentCapabilities  AgentCapabilities
+	clientCapabilities ClientCapabilities
+	initialized        bool
+	authRequired       bool
+}
+
+func (h *agentInboundHandler) capabilities() AgentCapabilities {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.agentCapabilities
+}
+
+func (h *agentInboundHandler) peerCapabilities() (ClientCapabilities, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.clientCapabilities, h.initialized
+}
+
+// builtinRouter 返回由 Agent 接口生成的默认注册，簿记逻辑作为 routeHook 安装，
+// 用户 Router 覆盖内置方法时同样执行。
+func (h *agentInboundHandler) builtinRouter() *Router {
+	h.routerOnce.Do(func() {
+		r := NewRouter()
+		Handle(r, AgentMethods.Initialize, h.agent.Initialize)
+		Handle(r, AgentMethods.Authenticate, h.agent.Authenticate)
+		Handle(r, AgentMethods.SessionNew, h.agent.NewSession)
+		Handle(r, AgentMethods.SessionLoad, h.agent.LoadSession)
+		Handle(r, AgentMethods.SessionSetMode, h.agent.SetSessionMode)
+		Handle(r, AgentMethods.SessionSetModel, h.agent.SetSessionModel)
+		Handle(r, AgentMethods.SessionPrompt, h.agent.Prompt)
+		HandleNotification(r, AgentMethods.SessionCancel, h.agent.Cancel)
+		if h.opts.unstable {
+			registerUnstableAgentMethods(r, h.agent)
+		}
+		r.hook(AgentMethods.Initialize, hookRequest(h.initialize))
+		r.hook(AgentMethods.SessionNew, hookRequest(h.newSession))
+		r.hook(AgentMethods.SessionLoad, hookRequest(h.loadSession))
+		r.hook(AgentMethods.SessionSetMode, hookRequest(h.setSessionMode))
+		r.hook(AgentMethods.SessionSetModel, hookRequest(h.setSessionModel))
+		r.hook(AgentMethods.SessionPrompt, hookRequest(h.prompt))
+		r.hook(AgentMethods.SessionCancel, hookNotification(h.cancel))
+		h.router = r
+	})
+	return h.router
+}
+
+// initialize 协商协议版本，并记录双方能力与是否需要认证。
+func (h *agentInboundHandler) initialize(ctx context.Context, req InitializeRequest, next func(context.Context, InitializeRequest) (InitializeResponse, error)) (InitializeResponse, error) {
+	resp, err := next(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	supported := h.opts.supportedVersions()
+	if !resp.ProtocolVersion.IsSet() {
+		// Agent 未指定版本时按本端支持的版本协商。
+		resp.ProtocolVersion = NegotiateProtocolVersion(req.ProtocolVersion, supported)
+	} else if !supportsProtocolVersion(resp.ProtocolVersion, supported) {
+		return InitializeResponse{}, InternalError().WithData((&ErrUnsupportedProtocolVersion{Version: resp.ProtocolVersion, Supported: supported}).Error())
+	}
+	h.mu.Lock()
+	h.agentCapabilities = resp.AgentCapabilities
+	h.clientCapabilities = req.ClientCapabilities
+	h.initialized = true
+	h.authRequired = len(resp.AuthMethods) > 0
+	h.mu.Unlock()
+	return resp, nil
+}
+
+func (h *agentInboundHandler) newSession(ctx context.Context, req NewSessionRequest, next func(context.Context, NewSessionRequest) (NewSessionResponse, error)) (NewSessionResponse, error) {
+	req.EnsureCWD()
+	if err := checkMcpServers(req.McpServers, h.capabilities().McpCapabilities); err != nil {
+		return NewSessionResponse{}, InvalidParams().WithData(err.Error())
+	}
+	resp, err := next(ctx, req)
+	if err == nil {
+		h.idle.touch(resp.SessionID)
+	}
+	return resp, err
+}
+
+func (h *agentInboundHandler) loadSession(ctx context.Context, req LoadSessionRequest, next func(context.Context, LoadSessionRequest) (LoadSessionResponse, error)) (LoadSessionResponse, error) {
+	if err := checkMcpServers(req.McpServers, h.capabilities().McpCapabilities); err != nil {
+		return LoadSessionResponse{}, InvalidParams().WithData(err.Error())
+	}
+	resp, err := next(ctx, req)
+	if err == nil {
+		h.idle.touch(req.SessionID)
+	}
+	return resp, err
+}
+
+func (h *agentInboundHandler) setSessionMode(ctx context.Context, req SetSessionModeRequest, next func(context.Context, SetSessionModeRequest) (SetSessionModeResponse, error)) (SetSessionModeResponse, error) {
+	resp, err := next(ctx, req)
+	if err == nil {
+		h.idle.touch(req.SessionID)
+	}
+	return resp, err
+}
+
+func (h *agentInboundHandler) setSessionModel(ctx context.Context, req SetSessionModelRequest, next func(context.Context, SetSessionModelRequest) (SetSessionModelResponse, error)) (SetSessionModelResponse, error) {
+	resp, err := next(ctx, req)
+	if err == nil {
+		h.idle.touch(req.SessionID)
+	}
+	return resp, err
 }
 
 func (h *agentInboundHandler) handleRequest(ctx context.Context, method string, params json.RawMessage) (any, Error, bool) {
-	switch method {
-	case AgentMethods.Initialize:
-		req, err := decodeParams[InitializeRequest](params)
-		if err != nil {
-			return nil, InvalidParams().WithData(err.Error()), true
-		}
-		resp, callErr := h.agent.Initialize(ctx, req)
-		if callErr != nil {
-			return nil, IntoInternalError(callErr), true
-		}
-		return resp, Error{}, true
-	case AgentMethods.Authenticate:
-		req, err := decodeParams[AuthenticateRequest](params)
-		if err != nil {
-			return nil, InvalidParams().WithData(err.Error()), true
-		}
-		resp, callErr := h.agent.Authenticate(ctx, req)
-		if callErr != nil {
-			return nil, IntoInternalError(callErr), true
-		}
-		return resp, Error{}, true
-	case AgentMethods.SessionNew:
-		req, err := decodeParams[NewSessionRequest](params)
-		if err != nil {
-			return nil, InvalidParams().WithData(err.Error()), true
-		}
-		req.EnsureCWD()
-		resp, callErr := h.agent.NewSession(ctx, req)
-		if callErr != nil {
-			return nil, IntoInternalError(callErr), true
-		}
-		return resp, Error{}, true
-	case AgentMethods.SessionLoad:
-		req, err := decodeParams[LoadSessionRequest](params)
-		if err != nil {
-			return nil, InvalidParams().WithData(err.Error()), true
-		}
-		resp, callErr := h.agent.LoadSession(ctx, req)
-		if callErr != nil {
-			return nil, IntoInternalError(callErr), true
-		}
-		return resp, Error{}, true
-	case AgentMethods.SessionSetMode:
-		req, err := decodeParams[SetSessionModeRequest](params)
-		if err != nil {
-			return nil, InvalidParams().WithData(err.Error()), true
-		}
-		resp, callErr := h.agent.SetSessionMode(ctx, req)
-		if callErr != nil {
-			return nil, IntoInternalError(callErr), true
-		}
-		return resp, Error{}, true
-	case AgentMethods.SessionSetModel:
-		req, err := decodeParams[SetSessionModelRequest](params)
-		if err != nil {
-			return nil, InvalidParams().WithData(err.Error()), true
-		}
-		resp, callErr := h.agent.SetSessionModel(ctx, req)
-		if callErr != nil {
-			return nil, IntoInternalError(callErr), true
-		}
-		return resp, Error{}, true
-	case AgentMethods.SessionPrompt:
-		req, err := decodeParams[PromptRequest](params)
-		if err != nil {
-			return nil, InvalidParams().WithData(err.Error()), true
+	if method == AgentMethods.Initialize {
+		return h.handleInitialize(ctx, params)
+	}
+	if err := h.lifecycle.check(h.opts); err != nil {
+		return nil, h.opts.toError(err), true
+	}
+	if err := h.checkAuthenticated(method); err != nil {
+		return nil, h.opts.toError(err), true
+	}
+	if resp, errObj, ok := dispatchRequest(ctx, h.opts, h.builtinRouter(), method, params); ok {
+		if method == AgentMethods.Authenticate && errObj.Code == 0 && errObj.Message == "" {
+			h.mu.Lock()
+			authRequired := h.authRequired
+			h.mu.Unlock()
+			// 只有声明了认证方式时认证才有意义。
+			if authRequired {
+				h.lifecycle.advance(StateAuthenticated, h.opts.stateHandlers)
+			}
 		}
-		resp, callErr := h.agent.Prompt(ctx, req)
+		return resp, errObj, true
+	}
+	if strings.HasPrefix(method, "_") {
+		req := ExtRequest{
+			Method: strings.TrimPrefix(method, "_"),
+			Params: params,
+		}
+		resp, callErr := h.opts.interceptInbound(ctx, CallInfo{Method: method}, req, func(ctx context.Context, params any) (any, error) {
+			ext, err := paramsAs[ExtRequest](params)
+			if err != nil {
+				return nil, err
+			}
+			return h.agent.ExtMethod(ctx, ext)
+		})
 		if callErr != nil {
-			return nil, IntoInternalError(callErr), true
+			return nil, h.opts.toError(callErr), true
 		}
 		return resp, Error{}, true
-	default:
-		if strings.HasPrefix(method, "_") {
-			req := ExtRequest{
-				Method: strings.TrimPrefix(method, "_"),
-				Params: params,
-			}
-			resp, callErr := h.agent.ExtMethod(ctx, req)
-			if callErr != nil {
-				return nil, IntoInternalError(callErr), true
-			}
-			return resp, Error{}, true
-		}
-		return nil, MethodNotFound(), true
 	}
+	return nil, MethodNotFound(), true
+}
+
+// handleInitialize 占用 initialize 后再分发，失败时回滚生命周期状态。
+func (h *agentInboundHandler) handleInitialize(ctx context.Context, params json.RawMessage) (any, Error, bool) {
+	finish, err := h.lifecycle.beginInitialize(h.opts)
+	if err != nil {
+		return nil, h.opts.toError(err), true
+	}
+	resp, errObj, _ := dispatchRequest(ctx, h.opts, h.builtinRouter(), AgentMethods.Initialize, params)
+	finish(errObj.Code == 0 && errObj.Message == "")
+	return resp, errObj, true
 }
 
 func (h *agentInboundHandler) handleNotification(ctx context.Context, method string, params json.RawMessage) Error {
-	switch method {
-	case AgentMethods.SessionCancel:
-		req, err := decodeParams[CancelNotification](params)
-		if err != nil {
-			return InvalidParams().WithData(err.Error())
-		}
-		if callErr := h.agent.Cancel(ctx, req); callErr != nil {
-			return IntoInternalError(callErr)
-		}
-		return Error{}
-	default:
-		if strings.HasPrefix(method, "_") {
-			notification := ExtNotification{
-				Method: strings.TrimPrefix(method, "_"),
-				Params: params,
-			}
-			if callErr := h.agent.ExtNotification(ctx, notification); callErr != nil {
-				return IntoInternalError(callErr)
+	if err := h.lifecycle.check(h.opts); err != nil {
+		return h.opts.toError(err)
+	}
+	if err := h.checkAuthenticated(method); err != nil {
+		return h.opts.toError(err)
+	}
+	if errObj, ok := dispatchNotification(ctx, h.opts, h.builtinRouter(), method, params); ok {
+		return errObj
+	}
+	if strings.HasPrefix(method, "_") {
+		notification := ExtNotification{
+			Method: strings.TrimPrefix(method, "_"),
+			Params: params,
+		}
+		_, callErr := h.opts.interceptInbound(ctx, CallInfo{Method: method, Notification: true}, notification, func(ctx context.Context, params any) (any, error) {
+			ext, err := paramsAs[ExtNotification](params)
+			if err != nil {
+				return nil, err
 			}
-			return Error{}
+			return nil, h.agent.ExtNotification(ctx, ext)
+		})
+		if callErr != nil {
+			return h.opts.toError(callErr)
 		}
-		return MethodNotFound()
+		return Error{}
 	}
+	return MethodNotFound()
+}
+
+func (h *agentInboundHandler) checkOutbound(string) error {
+	return h.lifecycle.check(h.opts)
+}
+
+func (h *agentInboundHandler) handleClose(err error) {
+	h.turns.cancelAll(connectionClosedError(err))
+	h.idle.stop()
+	h.lifecycle.advance(StateClosed, h.opts.stateHandlers)
 }
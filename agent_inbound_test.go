@@ -3,6 +3,8 @@ package acp
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"testing"
 )
 
@@ -146,3 +148,45 @@ func TestAgentInboundHandleSetModel(t *testing.T) {
 		t.Fatalf("unexpected response type %T", resp)
 	}
 }
+
+type erroringAgent struct {
+	UnimplementedAgent
+	err error
+}
+
+func (a *erroringAgent) Authenticate(context.Context, AuthenticateRequest) (AuthenticateResponse, error) {
+	return AuthenticateResponse{}, a.err
+}
+
+func TestAgentInboundPreservesTypedError(t *testing.T) {
+	agent := &erroringAgent{err: fmt.Errorf("login: %w", AuthRequired())}
+	handler := &agentInboundHandler{agent: agent}
+	_, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.Authenticate, mustRawJSON(AuthenticateRequest{MethodID: "token"}))
+	if errObj.Code != ErrorCodeAuthRequired.Code {
+		t.Fatalf("expected auth required, got %+v", errObj)
+	}
+}
+
+func TestAgentInboundErrorMapper(t *testing.T) {
+	errQuota := errors.New("quota exceeded")
+	agent := &erroringAgent{err: errQuota}
+	handler := &agentInboundHandler{
+		agent: agent,
+		opts: newConnectionOptions([]ConnectionOption{WithErrorMapper(func(err error) (Error, bool) {
+			if errors.Is(err, errQuota) {
+				return Error{Code: -32099, Message: "Quota exceeded"}, true
+			}
+			return Error{}, false
+		})}),
+	}
+	_, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.Authenticate, mustRawJSON(AuthenticateRequest{MethodID: "token"}))
+	if errObj.Code != -32099 {
+		t.Fatalf("expected mapped error, got %+v", errObj)
+	}
+
+	agent.err = errors.New("other")
+	_, errObj, _ = handler.handleRequest(context.Background(), AgentMethods.Authenticate, mustRawJSON(AuthenticateRequest{MethodID: "token"}))
+	if errObj.Code != ErrorCodeInternalError.Code {
+		t.Fatalf("expected internal error, got %+v", errObj)
+	}
+}
@@ -22,6 +22,8 @@ type InitializeRequest struct {
 
 // InitializeResponse 为初始化响应。
 type InitializeResponse struct {
+	// ProtocolVersion 留空时由 SDK 按请求与本端支持的版本协商；
+	// 指定的版本必须在本端支持列表中。
 	ProtocolVersion   ProtocolVersion   `json:"protocolVersion"`
 	AgentCapabilities AgentCapabilities `json:"agentCapabilities"`
 	AuthMethods       []AuthMethod      `json:"authMethods,omitempty"`
@@ -94,17 +96,6 @@ type EnvVariable struct {
 	Meta  json.RawMessage `json:"_meta,omitempty"`
 }
 
-// McpServer MCP 服务配置。
-type McpServer struct {
-	Type    McpServerType `json:"type"`
-	Name    string        `json:"name"`
-	URL     string        `json:"url,omitempty"`
-	Headers []HttpHeader  `json:"headers,omitempty"`
-	Command string        `json:"command,omitempty"`
-	Args    []string      `json:"args,omitempty"`
-	Env     []EnvVariable `json:"env,omitempty"`
-}
-
 // NewSessionRequest 对应 session/new 请求。
 type NewSessionRequest struct {
 	CWD        string          `json:"cwd"`
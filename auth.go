@@ -0,0 +1,77 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// WithRequireAuthentication 要求在 InitializeResponse.AuthMethods 非空时，
+// 先成功调用 authenticate 才能使用 session/* 方法，否则返回 AuthRequired。
+// 尚未 initialize 的连接调用 session/* 方法同样返回 AuthRequired。
+func WithRequireAuthentication() ConnectionOption {
+	return func(o *connectionOptions) {
+		o.requireAuth = true
+	}
+}
+
+// checkAuthenticated 判断方法是否因尚未认证而应被拒绝。
+func (h *agentInboundHandler) checkAuthenticated(method string) error {
+	if !h.opts.requireAuth || !strings.HasPrefix(method, "session/") {
+		return nil
+	}
+	h.mu.Lock()
+	// 尚未 initialize 时不知道是否声明了认证方式，按需要认证处理。
+	authRequired := h.authRequired || !h.initialized
+	h.mu.Unlock()
+	if authRequired && h.lifecycle.State() != StateAuthenticated {
+		return AuthRequired()
+	}
+	return nil
+}
+
+// CredentialProvider 根据代理声明的认证方式准备凭据，并返回要发送的认证请求。
+type CredentialProvider func(ctx context.Context, methods []AuthMethod) (AuthenticateRequest, error)
+
+// UseAuthMethod 返回始终选择指定认证方式的 CredentialProvider，代理未声明该方式时返回错误。
+func UseAuthMethod(id AuthMethodID) CredentialProvider {
+	return func(_ context.Context, methods []AuthMethod) (AuthenticateRequest, error) {
+		for _, method := range methods {
+			if method.ID == id {
+				return AuthenticateRequest{MethodID: id}, nil
+			}
+		}
+		return AuthenticateRequest{}, fmt.Errorf("acp: auth method %q not advertised by agent", id)
+	}
+}
+
+// AuthMethods 返回代理在 initialize 响应中声明的认证方式。
+func (c *ClientSideConnection) AuthMethods() []AuthMethod {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]AuthMethod(nil), c.authMethods...)
+}
+
+// AuthenticateWith 通过 provider 选择认证方式并调用 authenticate。
+func (c *ClientSideConnection) AuthenticateWith(ctx context.Context, provider CredentialProvider) error {
+	req, err := provider(ctx, c.AuthMethods())
+	if err != nil {
+		return err
+	}
+	_, err = c.Authenticate(ctx, req)
+	return err
+}
+
+// CallWithAuth 执行 call，若代理返回 AuthRequired 则通过 provider 认证后重试一次。
+func CallWithAuth[T any](ctx context.Context, conn *ClientSideConnection, provider CredentialProvider, call func(context.Context) (T, error)) (T, error) {
+	resp, err := call(ctx)
+	if err == nil || !errors.Is(err, ErrAuthRequired) {
+		return resp, err
+	}
+	if authErr := conn.AuthenticateWith(ctx, provider); authErr != nil {
+		var zero T
+		return zero, authErr
+	}
+	return call(ctx)
+}
@@ -0,0 +1,69 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRequireAuthenticationAndRetry(t *testing.T) {
+	ctx := context.Background()
+
+	authenticated := AuthMethodID("")
+	agent := &mockAgent{cancelCh: make(chan CancelNotification, 1)}
+	agent.initializeFunc = func(context.Context, InitializeRequest) (InitializeResponse, error) {
+		return InitializeResponse{
+			AuthMethods: []AuthMethod{{ID: "api-key", Name: "API key"}},
+		}, nil
+	}
+	agent.authenticateFunc = func(_ context.Context, req AuthenticateRequest) (AuthenticateResponse, error) {
+		authenticated = req.MethodID
+		return AuthenticateResponse{}, nil
+	}
+	agent.newSessionFunc = func(context.Context, NewSessionRequest) (NewSessionResponse, error) {
+		return NewSessionResponse{SessionID: "sess"}, nil
+	}
+	client := &mockClient{sessionUpdateCh: make(chan SessionNotification, 1)}
+
+	_, clientConn := connectPair(t, agent, client, []ConnectionOption{WithRequireAuthentication()})
+
+	if _, err := clientConn.Initialize(ctx, InitializeRequest{ProtocolVersion: ProtocolVersionV1}); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	if methods := clientConn.AuthMethods(); len(methods) != 1 || methods[0].ID != "api-key" {
+		t.Fatalf("unexpected auth methods %+v", methods)
+	}
+
+	if _, err := clientConn.NewSession(ctx, NewSessionRequest{CWD: "/tmp"}); !errors.Is(err, ErrAuthRequired) {
+		t.Fatalf("expected auth required, got %v", err)
+	}
+
+	resp, err := CallWithAuth(ctx, clientConn, UseAuthMethod("api-key"), func(ctx context.Context) (NewSessionResponse, error) {
+		return clientConn.NewSession(ctx, NewSessionRequest{CWD: "/tmp"})
+	})
+	if err != nil {
+		t.Fatalf("call with auth failed: %v", err)
+	}
+	if resp.SessionID != "sess" || authenticated != "api-key" {
+		t.Fatalf("unexpected result %+v (authenticated=%q)", resp, authenticated)
+	}
+}
+
+func TestUseAuthMethodRejectsUnknownMethod(t *testing.T) {
+	provider := UseAuthMethod("oauth")
+	if _, err := provider(context.Background(), []AuthMethod{{ID: "api-key"}}); err == nil {
+		t.Fatalf("expected error for unadvertised method")
+	}
+}
+
+func TestRequireAuthenticationBeforeInitialize(t *testing.T) {
+	agent := &mockAgent{newSessionFunc: func(context.Context, NewSessionRequest) (NewSessionResponse, error) {
+		t.Error("session/new reached the agent without initialize")
+		return NewSessionResponse{SessionID: "sess"}, nil
+	}}
+	_, clientConn := connectPair(t, agent, &mockClient{}, []ConnectionOption{WithRequireAuthentication()})
+
+	if _, err := clientConn.NewSession(context.Background(), NewSessionRequest{CWD: "/tmp"}); !errors.Is(err, ErrAuthRequired) {
+		t.Fatalf("expected auth required without initialize, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package acp
+
+import "fmt"
+
+// ErrCapabilityNotSupported 表示对端在 initialize 中未声明调用所需的能力。
+type ErrCapabilityNotSupported struct {
+	Method     string
+	Capability string
+}
+
+// Error 实现 error 接口。
+func (e *ErrCapabilityNotSupported) Error() string {
+	return fmt.Sprintf("acp: %s requires peer capability %q", e.Method, e.Capability)
+}
+
+// requireClientCapability 检查客户端是否声明了方法所需的能力。
+func requireClientCapability(caps ClientCapabilities, initialized bool, method string) error {
+	var capability string
+	var supported bool
+	switch method {
+	case ClientMethods.FSReadTextFile:
+		capability, supported = "fs.readTextFile", caps.FS.ReadTextFile
+	case ClientMethods.FSWriteTextFile:
+		capability, supported = "fs.writeTextFile", caps.FS.WriteTextFile
+	case ClientMethods.TerminalCreate,
+		ClientMethods.TerminalOutput,
+		ClientMethods.TerminalRelease,
+		ClientMethods.TerminalWaitForExit,
+		ClientMethods.TerminalKill:
+		capability, supported = "terminal", caps.Terminal
+	default:
+		return nil
+	}
+	if initialized && supported {
+		return nil
+	}
+	return &ErrCapabilityNotSupported{Method: method, Capability: capability}
+}
@@ -4,11 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"sync"
 )
 
 // ClientSideConnection 为客户端提供 Agent 接口。
 type ClientSideConnection struct {
-	rpc *rpcConnection
+	rpc     *rpcConnection
+	handler *clientInboundHandler
+	opts    connectionOptions
+
+	mu          sync.Mutex
+	authMethods []AuthMethod
 }
 
 // NewClientSideConnection 创建客户端侧连接。
@@ -17,11 +23,23 @@ func NewClientSideConnection(
 	client Client,
 	outgoing io.Writer,
 	incoming io.Reader,
+	opts ...ConnectionOption,
 ) *ClientSideConnection {
-	handler := &clientInboundHandler{client: client}
-	return &ClientSideConnection{
-		rpc: newRPCConnection(ctx, handler, outgoing, incoming),
-	}
+	options := newConnectionOptions(opts)
+	handler := &clientInboundHandler{client: client, opts: options}
+	conn := &ClientSideConnection{
+		rpc:     newRPCConnection(ctx, handler, outgoing, incoming, options),
+		handler: handler,
+		opts:    options,
+	}
+	conn.rpc.peer = conn
+	conn.rpc.start(ctx)
+	return conn
+}
+
+// State 返回连接当前的生命周期状态。
+func (c *ClientSideConnection) State() ConnectionState {
+	return c.handler.lifecycle.State()
 }
 
 // Close 关闭连接。
@@ -35,7 +53,19 @@ func (c *ClientSideConnection) Subscribe() StreamReceiver {
 }
 
 // Initialize 调用 initialize 方法。
+//
+// 若代理选择的协议版本不在本端支持列表中，连接会被关闭并返回 *ErrUnsupportedProtocolVersion。
 func (c *ClientSideConnection) Initialize(ctx context.Context, req InitializeRequest) (InitializeResponse, error) {
+	finish, err := c.handler.lifecycle.beginInitialize(c.opts)
+	if err != nil {
+		return InitializeResponse{}, err
+	}
+	resp, err := c.initialize(ctx, req)
+	finish(err == nil)
+	return resp, err
+}
+
+func (c *ClientSideConnection) initialize(ctx context.Context, req InitializeRequest) (InitializeResponse, error) {
 	var resp InitializeResponse
 	raw, err := c.rpc.request(ctx, AgentMethods.Initialize, req)
 	if err != nil {
@@ -44,6 +74,14 @@ func (c *ClientSideConnection) Initialize(ctx context.Context, req InitializeReq
 	if err := json.Unmarshal(raw, &resp); err != nil {
 		return resp, err
 	}
+	if supported := c.opts.supportedVersions(); !supportsProtocolVersion(resp.ProtocolVersion, supported) {
+		versionErr := &ErrUnsupportedProtocolVersion{Version: resp.ProtocolVersion, Supported: supported}
+		c.rpc.Close(versionErr)
+		return resp, versionErr
+	}
+	c.mu.Lock()
+	c.authMethods = append([]AuthMethod(nil), resp.AuthMethods...)
+	c.mu.Unlock()
 	return resp, nil
 }
 
@@ -57,6 +95,9 @@ func (c *ClientSideConnection) Authenticate(ctx context.Context, req Authenticat
 	if err := json.Unmarshal(raw, &resp); err != nil {
 		return resp, err
 	}
+	if len(c.AuthMethods()) > 0 {
+		c.handler.lifecycle.advance(StateAuthenticated, c.opts.stateHandlers)
+	}
 	return resp, nil
 }
 
@@ -133,10 +174,10 @@ func (c *ClientSideConnection) Cancel(ctx context.Context, note CancelNotificati
 	return c.rpc.notify(ctx, AgentMethods.SessionCancel, note)
 }
 
-// ExtMethod 调用扩展方法。
+// ExtMethod 调用扩展方法，params 原样作为 _method 的参数发送。
 func (c *ClientSideConnection) ExtMethod(ctx context.Context, method string, params json.RawMessage) (ExtResponse, error) {
 	var resp ExtResponse
-	raw, err := c.rpc.request(ctx, "_"+method, ExtRequest{Method: method, Params: params})
+	raw, err := c.rpc.request(ctx, "_"+method, params)
 	if err != nil {
 		return resp, err
 	}
@@ -144,7 +185,7 @@ func (c *ClientSideConnection) ExtMethod(ctx context.Context, method string, par
 	return resp, nil
 }
 
-// ExtNotification 发送扩展通知。
+// ExtNotification 发送扩展通知，params 原样作为 _method 的参数发送。
 func (c *ClientSideConnection) ExtNotification(ctx context.Context, method string, params json.RawMessage) error {
-	return c.rpc.notify(ctx, "_"+method, ExtNotification{Method: method, Params: params})
+	return c.rpc.notify(ctx, "_"+method, params)
 }
@@ -5,134 +5,111 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 )
 
 type clientInboundHandler struct {
 	client Client
+	opts   connectionOptions
+
+	routerOnce sync.Once
+	router     *Router
+	lifecycle  connectionLifecycle
+	streams    promptStreams
+	terminals  terminalRegistry
+}
+
+// builtinRouter 返回由 Client 接口生成的默认注册，簿记逻辑作为 routeHook 安装，
+// 用户 Router 覆盖内置方法时同样执行。
+func (h *clientInboundHandler) builtinRouter() *Router {
+	h.routerOnce.Do(func() {
+		r := NewRouter()
+		Handle(r, ClientMethods.SessionRequestPermission, h.client.RequestPermission)
+		Handle(r, ClientMethods.FSWriteTextFile, h.client.WriteTextFile)
+		Handle(r, ClientMethods.FSReadTextFile, h.client.ReadTextFile)
+		Handle(r, ClientMethods.TerminalCreate, h.client.CreateTerminal)
+		Handle(r, ClientMethods.TerminalOutput, h.client.TerminalOutput)
+		Handle(r, ClientMethods.TerminalRelease, h.client.ReleaseTerminal)
+		Handle(r, ClientMethods.TerminalWaitForExit, h.client.WaitForTerminalExit)
+		Handle(r, ClientMethods.TerminalKill, h.client.KillTerminalCommand)
+		HandleNotification(r, ClientMethods.SessionUpdate, h.client.SessionNotification)
+		r.hook(ClientMethods.TerminalCreate, hookRequest(h.createTerminal))
+		r.hook(ClientMethods.TerminalRelease, hookRequest(h.releaseTerminal))
+		r.hook(ClientMethods.SessionUpdate, hookNotification(h.sessionNotification))
+		h.router = r
+	})
+	return h.router
 }
 
 func (h *clientInboundHandler) handleRequest(ctx context.Context, method string, params json.RawMessage) (any, Error, bool) {
-	switch method {
-	case ClientMethods.SessionRequestPermission:
-		req, err := decodeParams[RequestPermissionRequest](params)
-		if err != nil {
-			return nil, InvalidParams().WithData(err.Error()), true
-		}
-		resp, callErr := h.client.RequestPermission(ctx, req)
-		if callErr != nil {
-			return nil, IntoInternalError(callErr), true
-		}
-		return resp, Error{}, true
-	case ClientMethods.FSWriteTextFile:
-		req, err := decodeParams[WriteTextFileRequest](params)
-		if err != nil {
-			return nil, InvalidParams().WithData(err.Error()), true
-		}
-		resp, callErr := h.client.WriteTextFile(ctx, req)
-		if callErr != nil {
-			return nil, IntoInternalError(callErr), true
-		}
-		return resp, Error{}, true
-	case ClientMethods.FSReadTextFile:
-		req, err := decodeParams[ReadTextFileRequest](params)
-		if err != nil {
-			return nil, InvalidParams().WithData(err.Error()), true
-		}
-		resp, callErr := h.client.ReadTextFile(ctx, req)
-		if callErr != nil {
-			return nil, IntoInternalError(callErr), true
-		}
-		return resp, Error{}, true
-	case ClientMethods.TerminalCreate:
-		req, err := decodeParams[CreateTerminalRequest](params)
-		if err != nil {
-			return nil, InvalidParams().WithData(err.Error()), true
-		}
-		resp, callErr := h.client.CreateTerminal(ctx, req)
-		if callErr != nil {
-			return nil, IntoInternalError(callErr), true
-		}
-		return resp, Error{}, true
-	case ClientMethods.TerminalOutput:
-		req, err := decodeParams[TerminalOutputRequest](params)
-		if err != nil {
-			return nil, InvalidParams().WithData(err.Error()), true
-		}
-		resp, callErr := h.client.TerminalOutput(ctx, req)
-		if callErr != nil {
-			return nil, IntoInternalError(callErr), true
-		}
-		return resp, Error{}, true
-	case ClientMethods.TerminalRelease:
-		req, err := decodeParams[ReleaseTerminalRequest](params)
-		if err != nil {
-			return nil, InvalidParams().WithData(err.Error()), true
-		}
-		resp, callErr := h.client.ReleaseTerminal(ctx, req)
-		if callErr != nil {
-			return nil, IntoInternalError(callErr), true
-		}
-		return resp, Error{}, true
-	case ClientMethods.TerminalWaitForExit:
-		req, err := decodeParams[WaitForTerminalExitRequest](params)
-		if err != nil {
-			return nil, InvalidParams().WithData(err.Error()), true
-		}
-		resp, callErr := h.client.WaitForTerminalExit(ctx, req)
-		if callErr != nil {
-			return nil, IntoInternalError(callErr), true
-		}
-		return resp, Error{}, true
-	case ClientMethods.TerminalKill:
-		req, err := decodeParams[KillTerminalCommandRequest](params)
-		if err != nil {
-			return nil, InvalidParams().WithData(err.Error()), true
-		}
-		resp, callErr := h.client.KillTerminalCommand(ctx, req)
+	if err := h.lifecycle.check(h.opts); err != nil {
+		return nil, h.opts.toError(err), true
+	}
+	if resp, errObj, ok := dispatchRequest(ctx, h.opts, h.builtinRouter(), method, params); ok {
+		return resp, errObj, true
+	}
+	if strings.HasPrefix(method, "_") {
+		req := ExtRequest{
+			Method: strings.TrimPrefix(method, "_"),
+			Params: params,
+		}
+		resp, callErr := h.opts.interceptInbound(ctx, CallInfo{Method: method}, req, func(ctx context.Context, params any) (any, error) {
+			ext, err := paramsAs[ExtRequest](params)
+			if err != nil {
+				return nil, err
+			}
+			return h.client.ExtMethod(ctx, ext)
+		})
 		if callErr != nil {
-			return nil, IntoInternalError(callErr), true
+			return nil, h.opts.toError(callErr), true
 		}
 		return resp, Error{}, true
-	default:
-		if strings.HasPrefix(method, "_") {
-			req := ExtRequest{
-				Method: strings.TrimPrefix(method, "_"),
-				Params: params,
-			}
-			resp, callErr := h.client.ExtMethod(ctx, req)
-			if callErr != nil {
-				return nil, IntoInternalError(callErr), true
-			}
-			return resp, Error{}, true
-		}
-		return nil, MethodNotFound(), true
 	}
+	return nil, MethodNotFound(), true
 }
 
 func (h *clientInboundHandler) handleNotification(ctx context.Context, method string, params json.RawMessage) Error {
-	switch method {
-	case ClientMethods.SessionUpdate:
-		req, err := decodeParams[SessionNotification](params)
-		if err != nil {
-			return InvalidParams().WithData(err.Error())
-		}
-		if callErr := h.client.SessionNotification(ctx, req); callErr != nil {
-			return IntoInternalError(callErr)
-		}
-		return Error{}
-	default:
-		if strings.HasPrefix(method, "_") {
-			notification := ExtNotification{
-				Method: strings.TrimPrefix(method, "_"),
-				Params: params,
-			}
-			if callErr := h.client.ExtNotification(ctx, notification); callErr != nil {
-				return IntoInternalError(callErr)
+	if err := h.lifecycle.check(h.opts); err != nil {
+		return h.opts.toError(err)
+	}
+	if errObj, ok := dispatchNotification(ctx, h.opts, h.builtinRouter(), method, params); ok {
+		return errObj
+	}
+	if strings.HasPrefix(method, "_") {
+		notification := ExtNotification{
+			Method: strings.TrimPrefix(method, "_"),
+			Params: params,
+		}
+		_, callErr := h.opts.interceptInbound(ctx, CallInfo{Method: method, Notification: true}, notification, func(ctx context.Context, params any) (any, error) {
+			ext, err := paramsAs[ExtNotification](params)
+			if err != nil {
+				return nil, err
 			}
-			return Error{}
+			return nil, h.client.ExtNotification(ctx, ext)
+		})
+		if callErr != nil {
+			return h.opts.toError(callErr)
 		}
-		return MethodNotFound()
+		return Error{}
+	}
+	return MethodNotFound()
+}
+
+func (h *clientInboundHandler) checkOutbound(method string) error {
+	if method == AgentMethods.Initialize {
+		// ClientSideConnection.Initialize 已经通过 beginInitialize 占用。
+		return nil
+	}
+	return h.lifecycle.check(h.opts)
+}
+
+func (h *clientInboundHandler) handleClose(error) {
+	ctx, cancel := context.WithTimeout(context.Background(), terminalReclaimTimeout)
+	defer cancel()
+	if err := h.reclaimTerminals(ctx, ""); err != nil {
+		h.opts.log().Warn("acp: release terminal on close", "error", err)
 	}
+	h.lifecycle.advance(StateClosed, h.opts.stateHandlers)
 }
 
 func decodeParams[T any](params json.RawMessage) (T, error) {
@@ -25,11 +25,14 @@ const (
 
 // SessionUpdate 描述会话更新。
 type SessionUpdate struct {
-	Type           SessionUpdateType `json:"sessionUpdate"`
-	Content        *ContentBlock     `json:"content,omitempty"`
-	ToolCall       *ToolCall         `json:"toolCall,omitempty"`
-	ToolCallUpdate *ToolCallUpdate   `json:"toolCallUpdate,omitempty"`
-	Meta           json.RawMessage   `json:"_meta,omitempty"`
+	Type              SessionUpdateType  `json:"sessionUpdate"`
+	Content           *ContentBlock      `json:"content,omitempty"`
+	ToolCall          *ToolCall          `json:"toolCall,omitempty"`
+	ToolCallUpdate    *ToolCallUpdate    `json:"toolCallUpdate,omitempty"`
+	Entries           []PlanEntry        `json:"entries,omitempty"`
+	AvailableCommands []AvailableCommand `json:"availableCommands,omitempty"`
+	CurrentModeID     SessionModeID      `json:"currentModeId,omitempty"`
+	Meta              json.RawMessage    `json:"_meta,omitempty"`
 }
 
 // ToolCall 描述一次工具调用。
@@ -43,11 +46,74 @@ type ToolCall struct {
 // ToolCallUpdate 描述工具调用更新。
 type ToolCallUpdate struct {
 	ID     string          `json:"id"`
-	Status string          `json:"status"`
+	Status ToolCallStatus  `json:"status"`
 	Output json.RawMessage `json:"output,omitempty"`
 	Meta   json.RawMessage `json:"_meta,omitempty"`
 }
 
+// MarshalJSON 实现 json.Marshaler，plan 与 available_commands_update 始终携带列表字段。
+func (u SessionUpdate) MarshalJSON() ([]byte, error) {
+	type plain SessionUpdate
+	switch u.Type {
+	case SessionUpdateTypePlan:
+		entries := u.Entries
+		if entries == nil {
+			entries = []PlanEntry{}
+		}
+		return json.Marshal(struct {
+			plain
+			Entries []PlanEntry `json:"entries"`
+		}{plain(u), entries})
+	case SessionUpdateTypeAvailableCommands:
+		commands := u.AvailableCommands
+		if commands == nil {
+			commands = []AvailableCommand{}
+		}
+		return json.Marshal(struct {
+			plain
+			AvailableCommands []AvailableCommand `json:"availableCommands"`
+		}{plain(u), commands})
+	default:
+		return json.Marshal(plain(u))
+	}
+}
+
+// ToolCallStatus 工具调用状态。
+type ToolCallStatus string
+
+const (
+	ToolCallStatusPending    ToolCallStatus = "pending"
+	ToolCallStatusInProgress ToolCallStatus = "in_progress"
+	ToolCallStatusCompleted  ToolCallStatus = "completed"
+	ToolCallStatusFailed     ToolCallStatus = "failed"
+)
+
+// PlanEntry 描述执行计划中的一项。
+type PlanEntry struct {
+	Content  string            `json:"content"`
+	Priority PlanEntryPriority `json:"priority"`
+	Status   PlanEntryStatus   `json:"status"`
+	Meta     json.RawMessage   `json:"_meta,omitempty"`
+}
+
+// PlanEntryPriority 计划项优先级。
+type PlanEntryPriority string
+
+const (
+	PlanEntryPriorityHigh   PlanEntryPriority = "high"
+	PlanEntryPriorityMedium PlanEntryPriority = "medium"
+	PlanEntryPriorityLow    PlanEntryPriority = "low"
+)
+
+// PlanEntryStatus 计划项状态。
+type PlanEntryStatus string
+
+const (
+	PlanEntryStatusPending    PlanEntryStatus = "pending"
+	PlanEntryStatusInProgress PlanEntryStatus = "in_progress"
+	PlanEntryStatusCompleted  PlanEntryStatus = "completed"
+)
+
 // AvailableCommand 描述可用命令。
 type AvailableCommand struct {
 	Name        string          `json:"name"`
@@ -136,12 +202,13 @@ type ReadTextFileResponse struct {
 
 // CreateTerminalRequest 创建终端。
 type CreateTerminalRequest struct {
-	SessionID SessionID       `json:"sessionId"`
-	Command   string          `json:"command"`
-	Args      []string        `json:"args,omitempty"`
-	Env       []EnvVariable   `json:"env,omitempty"`
-	CWD       string          `json:"cwd,omitempty"`
-	Meta      json.RawMessage `json:"_meta,omitempty"`
+	SessionID       SessionID       `json:"sessionId"`
+	Command         string          `json:"command"`
+	Args            []string        `json:"args,omitempty"`
+	Env             []EnvVariable   `json:"env,omitempty"`
+	CWD             string          `json:"cwd,omitempty"`
+	OutputByteLimit *uint64         `json:"outputByteLimit,omitempty"`
+	Meta            json.RawMessage `json:"_meta,omitempty"`
 }
 
 // CreateTerminalResponse 创建终端响应。
@@ -204,11 +271,42 @@ type WaitForTerminalExitRequest struct {
 }
 
 // WaitForTerminalExitResponse 等待终端退出响应。
+//
+// 按照 ACP schema，退出状态字段在线上格式中与 _meta 平铺在同一层。
 type WaitForTerminalExitResponse struct {
-	ExitStatus TerminalExitStatus `json:"exitStatus"`
+	ExitStatus TerminalExitStatus `json:"-"`
 	Meta       json.RawMessage    `json:"_meta,omitempty"`
 }
 
+type waitForTerminalExitResponseWire struct {
+	ExitCode *uint32         `json:"exitCode,omitempty"`
+	Signal   *string         `json:"signal,omitempty"`
+	Meta     json.RawMessage `json:"_meta,omitempty"`
+}
+
+// MarshalJSON 实现 json.Marshaler。
+func (r WaitForTerminalExitResponse) MarshalJSON() ([]byte, error) {
+	return json.Marshal(waitForTerminalExitResponseWire{
+		ExitCode: r.ExitStatus.ExitCode,
+		Signal:   r.ExitStatus.Signal,
+		Meta:     r.Meta,
+	})
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler。
+func (r *WaitForTerminalExitResponse) UnmarshalJSON(data []byte) error {
+	var wire waitForTerminalExitResponseWire
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	r.ExitStatus = TerminalExitStatus{
+		ExitCode: wire.ExitCode,
+		Signal:   wire.Signal,
+	}
+	r.Meta = wire.Meta
+	return nil
+}
+
 // ClientCapabilities 描述客户端能力。
 type ClientCapabilities struct {
 	FS       FileSystemCapability `json:"fs"`
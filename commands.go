@@ -0,0 +1,334 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// CommandCall 描述一次斜杠命令调用。
+type CommandCall struct {
+	// Name 为不含 "/" 的命令名。
+	Name string
+	// Input 为命令名之后的原始文本，已去除首尾空白。
+	Input string
+	// Args 为按空白拆分的 Input，支持单引号与双引号包裹含空白的参数。
+	Args []string
+	// Request 为原始的 prompt 请求。
+	Request PromptRequest
+}
+
+// CommandHandler 处理斜杠命令，返回值作为 session/prompt 的响应。
+type CommandHandler func(ctx context.Context, call CommandCall) (PromptResponse, error)
+
+// Command 声明一个斜杠命令。
+type Command struct {
+	Name        string
+	Description string
+	// InputHint 为未提供输入时显示给用户的提示，为空表示命令不接受输入。
+	InputHint string
+	Handler   CommandHandler
+}
+
+// Commands 是代理的斜杠命令注册表。
+//
+// 通过 WithCommands 挂到 AgentSideConnection 后，session/new 与 session/load 成功响应后
+// 会发送 available_commands_update，首个文本块以已注册的 "/name" 开头的 prompt
+// 会交给对应的 CommandHandler，而不是 Agent.Prompt。注册表变化时会向已发布过的会话重新发布。
+type Commands struct {
+	mu       sync.Mutex
+	order    []string
+	commands map[string]Command
+	targets  map[commandTarget]*commandPublisher
+}
+
+// commandTarget 标识一个连接上的会话，同一注册表可以被多个连接共享。
+type commandTarget struct {
+	conn    *AgentSideConnection
+	session SessionID
+}
+
+func targetOf(sender *SessionSender) commandTarget {
+	return commandTarget{conn: sender.conn, session: sender.SessionID()}
+}
+
+// commandPublisher 向一个会话发送命令列表。同一会话的发送经 sendMu 串行，
+// 每次发送前才取快照，因此会话最后收到的总是最新列表；停止读取的对端只会阻塞自己的发送。
+type commandPublisher struct {
+	sendMu sync.Mutex
+
+	// 以下字段由 Commands.mu 保护。
+	sender  *SessionSender
+	dirty   bool
+	running bool
+}
+
+// NewCommands 创建空的命令注册表。
+func NewCommands() *Commands {
+	return &Commands{
+		commands: make(map[string]Command),
+		targets:  make(map[commandTarget]*commandPublisher),
+	}
+}
+
+// WithCommands 让代理侧连接发布并路由 c 中的斜杠命令。
+func WithCommands(c *Commands) ConnectionOption {
+	return func(o *connectionOptions) {
+		o.commands = c
+	}
+}
+
+// Register 注册命令，同名命令会被替换，随后在后台向已发布过的会话重新发布命令列表。
+func (c *Commands) Register(cmd Command) error {
+	if err := c.register(cmd); err != nil {
+		return err
+	}
+	c.republish()
+	return nil
+}
+
+func (c *Commands) register(cmd Command) error {
+	cmd.Name = strings.TrimPrefix(cmd.Name, "/")
+	if cmd.Name == "" || strings.IndexFunc(cmd.Name, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("acp: invalid command name %q", cmd.Name)
+	}
+	if cmd.Handler == nil {
+		return fmt.Errorf("acp: command %q has no handler", cmd.Name)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.commands[cmd.Name]; !ok {
+		c.order = append(c.order, cmd.Name)
+	}
+	c.commands[cmd.Name] = cmd
+	return nil
+}
+
+// Unregister 移除命令并在后台重新发布命令列表，返回命令是否存在。
+func (c *Commands) Unregister(name string) bool {
+	name = strings.TrimPrefix(name, "/")
+	c.mu.Lock()
+	if _, ok := c.commands[name]; !ok {
+		c.mu.Unlock()
+		return false
+	}
+	delete(c.commands, name)
+	for i, n := range c.order {
+		if n == name {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	c.mu.Unlock()
+	c.republish()
+	return true
+}
+
+// Available 按注册顺序返回用于 available_commands_update 的命令列表。
+func (c *Commands) Available() []AvailableCommand {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.available()
+}
+
+func (c *Commands) available() []AvailableCommand {
+	out := make([]AvailableCommand, 0, len(c.order))
+	for _, name := range c.order {
+		cmd := c.commands[name]
+		out = append(out, AvailableCommand{Name: cmd.Name, Description: cmd.Description, InputHint: cmd.InputHint})
+	}
+	return out
+}
+
+// Publish 向 sender 所属会话发送当前命令列表，之后注册表变化时也会通过 sender 重新发布。
+//
+// sender 的 ctx 需要在会话存续期间保持有效。
+func (c *Commands) Publish(sender *SessionSender) error {
+	target := targetOf(sender)
+	c.mu.Lock()
+	p := c.targets[target]
+	if p == nil {
+		p = &commandPublisher{}
+		c.targets[target] = p
+	}
+	p.sender = sender
+	c.mu.Unlock()
+
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	c.mu.Lock()
+	// 之前排队的重新发布由这次发送一并完成。
+	p.dirty = false
+	commands := c.available()
+	c.mu.Unlock()
+	return sender.AvailableCommands(commands)
+}
+
+// Forget 停止向会话重新发布命令列表，签名与 SessionExpireFunc 相同。
+// 注册表被多个连接共享时，所有连接上的同名会话都会被移除。
+func (c *Commands) Forget(id SessionID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for target := range c.targets {
+		if target.session == id {
+			delete(c.targets, target)
+		}
+	}
+}
+
+// republish 让已发布过的会话在后台收到最新命令列表，不等待发送完成。
+// 每个会话至多一个发送中的 goroutine，期间的多次变化合并为一次发送。
+func (c *Commands) republish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for target, p := range c.targets {
+		p.dirty = true
+		if !p.running {
+			p.running = true
+			go c.runPublisher(target, p)
+		}
+	}
+}
+
+// runPublisher 发送最新命令列表直到没有新的变化，发送失败的会话不再跟踪。
+func (c *Commands) runPublisher(target commandTarget, p *commandPublisher) {
+	for {
+		p.sendMu.Lock()
+		c.mu.Lock()
+		if !p.dirty || c.targets[target] != p {
+			p.running = false
+			c.mu.Unlock()
+			p.sendMu.Unlock()
+			return
+		}
+		p.dirty = false
+		sender := p.sender
+		commands := c.available()
+		c.mu.Unlock()
+		err := sender.AvailableCommands(commands)
+		p.sendMu.Unlock()
+		if err != nil {
+			c.mu.Lock()
+			p.running = false
+			if c.targets[target] == p {
+				delete(c.targets, target)
+			}
+			c.mu.Unlock()
+			return
+		}
+	}
+}
+
+// Lookup 解析 prompt 中的斜杠命令，命令未注册时返回 false。
+func (c *Commands) Lookup(req PromptRequest) (Command, CommandCall, bool) {
+	name, input, ok := ParseCommand(req.Prompt)
+	if !ok {
+		return Command{}, CommandCall{}, false
+	}
+	c.mu.Lock()
+	cmd, ok := c.commands[name]
+	c.mu.Unlock()
+	if !ok {
+		return Command{}, CommandCall{}, false
+	}
+	return cmd, CommandCall{Name: name, Input: input, Args: splitCommandArgs(input), Request: req}, true
+}
+
+// Dispatch 将斜杠命令交给对应的处理器，第二个返回值表示 prompt 是否为已注册的命令。
+func (c *Commands) Dispatch(ctx context.Context, req PromptRequest) (PromptResponse, bool, error) {
+	cmd, call, ok := c.Lookup(req)
+	if !ok {
+		return PromptResponse{}, false, nil
+	}
+	resp, err := cmd.Handler(ctx, call)
+	return resp, true, err
+}
+
+// ParseCommand 解析首个内容块中的 "/name input" 形式的命令。首个内容块不是文本、
+// 不以 "/" 开头或命令名为空时返回 false。
+func ParseCommand(prompt []ContentBlock) (name, input string, ok bool) {
+	if len(prompt) == 0 || prompt[0].Type != ContentBlockTypeText {
+		return "", "", false
+	}
+	text := strings.TrimLeftFunc(prompt[0].Text, unicode.IsSpace)
+	if !strings.HasPrefix(text, "/") {
+		return "", "", false
+	}
+	text = text[1:]
+	end := strings.IndexFunc(text, unicode.IsSpace)
+	if end < 0 {
+		end = len(text)
+	}
+	if end == 0 {
+		return "", "", false
+	}
+	return text[:end], strings.TrimSpace(text[end:]), true
+}
+
+// splitCommandArgs 按空白拆分参数，引号内的空白保留，未闭合的引号延续到末尾。
+func splitCommandArgs(input string) []string {
+	var (
+		args    []string
+		current strings.Builder
+		quote   rune
+		inArg   bool
+	)
+	for _, r := range input {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// afterResponse 在 session/new 与 session/load 的成功响应发出后发布命令列表。
+func (h *agentInboundHandler) afterResponse(ctx context.Context, method string, params json.RawMessage, res any) {
+	if h.opts.commands == nil {
+		return
+	}
+	var id SessionID
+	switch method {
+	case AgentMethods.SessionNew:
+		resp, ok := res.(NewSessionResponse)
+		if !ok {
+			return
+		}
+		id = resp.SessionID
+	case AgentMethods.SessionLoad:
+		req, err := decodeParams[LoadSessionRequest](params)
+		if err != nil {
+			return
+		}
+		id = req.SessionID
+	default:
+		return
+	}
+	client, ok := ClientFromContext(ctx)
+	if !ok || id == "" {
+		return
+	}
+	if err := h.opts.commands.Publish(client.SessionSender(context.WithoutCancel(ctx), id)); err != nil {
+		h.opts.log().Warn("acp: publish available commands", "session", string(id), "error", err)
+	}
+}
@@ -0,0 +1,257 @@
+package acp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text  string
+		name  string
+		input string
+		ok    bool
+	}{
+		{"/review src/main.go", "review", "src/main.go", true},
+		{"  /help", "help", "", true},
+		{"/plan\n  first step ", "plan", "first step", true},
+		{"/", "", "", false},
+		{"/ review", "", "", false},
+		{"please /review", "", "", false},
+	}
+	for _, tt := range tests {
+		name, input, ok := ParseCommand([]ContentBlock{NewTextContentBlock(tt.text)})
+		if name != tt.name || input != tt.input || ok != tt.ok {
+			t.Errorf("ParseCommand(%q) = %q, %q, %v", tt.text, name, input, ok)
+		}
+	}
+	if _, _, ok := ParseCommand(nil); ok {
+		t.Error("empty prompt should not parse as a command")
+	}
+}
+
+func TestSplitCommandArgs(t *testing.T) {
+	got := splitCommandArgs(`a "b c" 'd e'f  ""`)
+	want := []string{"a", "b c", "d ef", ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("splitCommandArgs = %q, want %q", got, want)
+	}
+}
+
+func TestCommandsRegisterValidates(t *testing.T) {
+	c := NewCommands()
+	noop := func(context.Context, CommandCall) (PromptResponse, error) { return PromptResponse{}, nil }
+	if err := c.Register(Command{Name: "bad name", Handler: noop}); err == nil {
+		t.Fatal("expected error for name with spaces")
+	}
+	if err := c.Register(Command{Name: "nohandler"}); err == nil {
+		t.Fatal("expected error for missing handler")
+	}
+	if err := c.Register(Command{Name: "/a", Description: "first", Handler: noop}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if err := c.Register(Command{Name: "b", Handler: noop}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if err := c.Register(Command{Name: "a", Description: "replaced", Handler: noop}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	got := c.Available()
+	if len(got) != 2 || got[0].Name != "a" || got[0].Description != "replaced" || got[1].Name != "b" {
+		t.Fatalf("unexpected available commands %+v", got)
+	}
+	if !c.Unregister("/b") || c.Unregister("b") {
+		t.Fatal("unexpected unregister result")
+	}
+}
+
+func TestCommandsPublishAndRoute(t *testing.T) {
+	commands := NewCommands()
+	calls := make(chan CommandCall, 1)
+	if err := commands.Register(Command{
+		Name:        "review",
+		Description: "Review a file",
+		InputHint:   "path to review",
+		Handler: func(_ context.Context, call CommandCall) (PromptResponse, error) {
+			calls <- call
+			return PromptResponse{StopReason: StopReasonEndTurn}, nil
+		},
+	}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+
+	prompts := make(chan PromptRequest, 1)
+	agent := &mockAgent{
+		newSessionFunc: func(context.Context, NewSessionRequest) (NewSessionResponse, error) {
+			return NewSessionResponse{SessionID: "s1"}, nil
+		},
+		promptFunc: func(_ context.Context, req PromptRequest) (PromptResponse, error) {
+			prompts <- req
+			return PromptResponse{StopReason: StopReasonEndTurn}, nil
+		},
+	}
+	client := &mockClient{sessionUpdateCh: make(chan SessionNotification, 8)}
+	_, clientConn := connectPair(t, agent, client, []ConnectionOption{WithCommands(commands)})
+	ctx := context.Background()
+
+	if _, err := clientConn.NewSession(ctx, NewSessionRequest{CWD: "/"}); err != nil {
+		t.Fatalf("new session failed: %v", err)
+	}
+	expectCommands := func(names ...string) {
+		t.Helper()
+		select {
+		case note := <-client.sessionUpdateCh:
+			if note.SessionID != "s1" || note.Update.Type != SessionUpdateTypeAvailableCommands {
+				t.Fatalf("unexpected update %+v", note)
+			}
+			var got []string
+			for _, cmd := range note.Update.AvailableCommands {
+				got = append(got, cmd.Name)
+			}
+			if !reflect.DeepEqual(got, names) {
+				t.Fatalf("published commands %v, want %v", got, names)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("available commands were not published")
+		}
+	}
+	expectCommands("review")
+
+	if _, err := clientConn.Prompt(ctx, PromptRequest{SessionID: "s1", Prompt: []ContentBlock{NewTextContentBlock("/review src/main.go")}}); err != nil {
+		t.Fatalf("command prompt failed: %v", err)
+	}
+	select {
+	case call := <-calls:
+		if call.Name != "review" || call.Input != "src/main.go" || !reflect.DeepEqual(call.Args, []string{"src/main.go"}) || call.Request.SessionID != "s1" {
+			t.Fatalf("unexpected command call %+v", call)
+		}
+	default:
+		t.Fatal("command handler was not called")
+	}
+
+	if _, err := clientConn.Prompt(ctx, PromptRequest{SessionID: "s1", Prompt: []ContentBlock{NewTextContentBlock("/unknown")}}); err != nil {
+		t.Fatalf("prompt failed: %v", err)
+	}
+	select {
+	case <-prompts:
+	default:
+		t.Fatal("unknown command should reach Agent.Prompt")
+	}
+
+	if err := commands.Register(Command{Name: "help", Handler: func(context.Context, CommandCall) (PromptResponse, error) {
+		return PromptResponse{StopReason: StopReasonEndTurn}, nil
+	}}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	expectCommands("review", "help")
+}
+
+func TestCommandsSharedAcrossConnections(t *testing.T) {
+	commands := NewCommands()
+	newSession := func(context.Context, NewSessionRequest) (NewSessionResponse, error) {
+		return NewSessionResponse{SessionID: "s1"}, nil
+	}
+	clients := make([]*mockClient, 2)
+	conns := make([]*ClientSideConnection, 2)
+	for i := range clients {
+		clients[i] = &mockClient{sessionUpdateCh: make(chan SessionNotification, 64)}
+		_, conns[i] = connectPair(t, &mockAgent{newSessionFunc: newSession}, clients[i], []ConnectionOption{WithCommands(commands)})
+		if _, err := conns[i].NewSession(context.Background(), NewSessionRequest{CWD: "/"}); err != nil {
+			t.Fatalf("new session failed: %v", err)
+		}
+		<-clients[i].sessionUpdateCh
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("cmd%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = commands.Register(Command{Name: name, Handler: func(context.Context, CommandCall) (PromptResponse, error) {
+				return PromptResponse{}, nil
+			}})
+		}()
+	}
+	wg.Wait()
+
+	for i, client := range clients {
+		// 重新发布在后台进行，先等到完整列表送达。
+		var last []AvailableCommand
+		for len(last) != 10 {
+			select {
+			case note := <-client.sessionUpdateCh:
+				last = note.Update.AvailableCommands
+			case <-time.After(time.Second):
+				t.Fatalf("client %d last received %d commands, want 10", i, len(last))
+			}
+		}
+		// 响应排在之前发出的所有通知之后，之后送达的列表也不能是旧的。
+		if _, err := conns[i].ExtMethod(context.Background(), "sync", mustRawJSON(map[string]string{})); err != nil {
+			t.Fatalf("sync request failed: %v", err)
+		}
+		for len(client.sessionUpdateCh) > 0 {
+			last = (<-client.sessionUpdateCh).Update.AvailableCommands
+		}
+		if len(last) != 10 {
+			t.Fatalf("client %d last received %d commands, want 10", i, len(last))
+		}
+	}
+}
+
+func TestCommandsStalledPeerDoesNotBlockRegister(t *testing.T) {
+	commands := NewCommands()
+	handler := func(context.Context, CommandCall) (PromptResponse, error) {
+		return PromptResponse{}, nil
+	}
+
+	// 对端从不读取输出，发送很快会填满缓冲区并阻塞。
+	stalledReader, stalledWriter := io.Pipe()
+	inReader, inWriter := io.Pipe()
+	stalled := NewAgentSideConnection(context.Background(), &mockAgent{}, stalledWriter, inReader)
+	t.Cleanup(func() {
+		stalledReader.Close()
+		inWriter.Close()
+		stalled.Close()
+	})
+	if err := commands.Publish(stalled.SessionSender(context.Background(), "stalled")); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+
+	client := &mockClient{sessionUpdateCh: make(chan SessionNotification, 128)}
+	agentConn, _ := connectPair(t, &mockAgent{}, client, nil)
+	if err := commands.Publish(agentConn.SessionSender(context.Background(), "s1")); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+	<-client.sessionUpdateCh
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 64; i++ {
+			_ = commands.Register(Command{Name: fmt.Sprintf("cmd%d", i), Handler: handler})
+			// 让发送追上注册，确保停止读取的对端填满缓冲区。
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("register blocked on a peer that stopped reading")
+	}
+
+	var last []AvailableCommand
+	for len(last) != 64 {
+		select {
+		case note := <-client.sessionUpdateCh:
+			last = note.Update.AvailableCommands
+		case <-time.After(time.Second):
+			t.Fatalf("healthy session last received %d commands, want 64", len(last))
+		}
+	}
+}
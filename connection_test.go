@@ -3,7 +3,9 @@ package acp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"strings"
 	"testing"
 	"time"
 )
@@ -317,3 +319,81 @@ func TestClientAgentRoundtrip(t *testing.T) {
 		t.Fatalf("unexpected stream message type: %s", msg.Content.Type)
 	}
 }
+
+func TestAgentConnectionRefusesUnadvertisedCapabilities(t *testing.T) {
+	ctx := context.Background()
+
+	agent := &mockAgent{cancelCh: make(chan CancelNotification, 1)}
+	client := &mockClient{sessionUpdateCh: make(chan SessionNotification, 1)}
+
+	agentConn, clientConn := connectPair(t, agent, client, nil)
+
+	if _, err := agentConn.ReadTextFile(ctx, ReadTextFileRequest{SessionID: "sess", Path: "/tmp/a"}); err == nil {
+		t.Fatalf("expected read to be refused before initialize")
+	}
+
+	if _, err := clientConn.Initialize(ctx, InitializeRequest{
+		ProtocolVersion: ProtocolVersionV1,
+		ClientCapabilities: ClientCapabilities{
+			FS: FileSystemCapability{ReadTextFile: true},
+		},
+	}); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+
+	caps, ok := agentConn.PeerCapabilities()
+	if !ok || !caps.FS.ReadTextFile || caps.Terminal {
+		t.Fatalf("unexpected peer capabilities %+v (ok=%v)", caps, ok)
+	}
+
+	readResp, err := agentConn.ReadTextFile(ctx, ReadTextFileRequest{SessionID: "sess", Path: "/tmp/a"})
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if readResp.Content != "example" {
+		t.Fatalf("unexpected content %q", readResp.Content)
+	}
+
+	_, err = agentConn.CreateTerminal(ctx, CreateTerminalRequest{SessionID: "sess", Command: "ls"})
+	var capErr *ErrCapabilityNotSupported
+	if !errors.As(err, &capErr) {
+		t.Fatalf("expected capability error, got %v", err)
+	}
+	if capErr.Capability != "terminal" {
+		t.Fatalf("unexpected capability %q", capErr.Capability)
+	}
+}
+
+func TestClientInitializeRejectsUnsupportedProtocolVersion(t *testing.T) {
+	ctx := context.Background()
+
+	agent := &mockAgent{cancelCh: make(chan CancelNotification, 1)}
+	client := &mockClient{sessionUpdateCh: make(chan SessionNotification, 1)}
+
+	_, clientConn := connectPair(t, agent, client, []ConnectionOption{WithProtocolVersions(ProtocolVersionV0)})
+
+	_, err := clientConn.Initialize(ctx, InitializeRequest{ProtocolVersion: ProtocolVersionV1})
+	var versionErr *ErrUnsupportedProtocolVersion
+	if !errors.As(err, &versionErr) {
+		t.Fatalf("expected unsupported protocol version error, got %v", err)
+	}
+	if versionErr.Version.Value() != ProtocolVersionV0.Value() {
+		t.Fatalf("unexpected negotiated version %d", versionErr.Version.Value())
+	}
+
+	if _, err := clientConn.NewSession(ctx, NewSessionRequest{CWD: "/tmp"}); err == nil {
+		t.Fatalf("expected connection to be closed")
+	}
+}
+
+func TestCloseFlushesQueuedMessages(t *testing.T) {
+	var out syncBuffer
+	conn := newRPCConnection(context.Background(), &clientInboundHandler{client: &mockClient{}}, &out, strings.NewReader(""), connectionOptions{})
+	id := NewRequestIDNumber(7)
+	conn.outgoing <- jsonrpcEnvelope{JSONRPC: "2.0", ID: &id, Result: ptr(json.RawMessage(`"done"`))}
+	conn.Close(io.EOF)
+	conn.writeLoop()
+	if !strings.Contains(out.String(), `"result":"done"`) {
+		t.Fatalf("queued response was dropped, wrote %q", out.String())
+	}
+}
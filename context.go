@@ -0,0 +1,81 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+)
+
+type peerContextKey struct{}
+
+type requestInfoContextKey struct{}
+
+// RequestInfo 描述当前正在处理的入站调用。
+type RequestInfo struct {
+	// ID 为请求 ID，通知时为 RequestIDNull。
+	ID           RequestID
+	Method       string
+	Notification bool
+	// Meta 为参数中的原始 _meta 字段，可能为空。
+	Meta json.RawMessage
+}
+
+// RequestInfoFromContext 返回当前入站调用的信息，仅在处理器的 ctx 中可用。
+func RequestInfoFromContext(ctx context.Context) (RequestInfo, bool) {
+	info, ok := ctx.Value(requestInfoContextKey{}).(RequestInfo)
+	return info, ok
+}
+
+// ClientFromContext 在 Agent 处理器中返回代理侧连接，它就是客户端的代理：
+// 通过它可以发送 session/update、调用 RequestPermission、读写文件与操作终端。
+func ClientFromContext(ctx context.Context) (*AgentSideConnection, bool) {
+	conn, ok := ctx.Value(peerContextKey{}).(*AgentSideConnection)
+	return conn, ok && conn != nil
+}
+
+// AgentFromContext 在 Client 处理器中返回客户端侧连接，它就是代理的代理。
+func AgentFromContext(ctx context.Context) (*ClientSideConnection, bool) {
+	conn, ok := ctx.Value(peerContextKey{}).(*ClientSideConnection)
+	return conn, ok && conn != nil
+}
+
+// PeerFromContext 返回处理当前调用的连接，只暴露两侧共有的扩展方法。
+//
+// 两侧连接的方法集不同，无法用同一个类型表示，因此 PeerFromContext 只适用于
+// 同时挂在两侧的拦截器等与角色无关的代码。处理器中应使用 ClientFromContext
+// 或 AgentFromContext 取得完整的对端代理。
+func PeerFromContext(ctx context.Context) (ExtCaller, bool) {
+	peer, ok := ctx.Value(peerContextKey{}).(ExtCaller)
+	return peer, ok && peer != nil
+}
+
+// inboundContext 为入站调用附加对端连接与请求信息。
+func (c *rpcConnection) inboundContext(ctx context.Context, method string, params json.RawMessage, id *RequestID) context.Context {
+	info := RequestInfo{
+		ID:           RequestIDNull,
+		Method:       method,
+		Notification: id == nil,
+		Meta:         extractMeta(params),
+	}
+	if id != nil {
+		info.ID = *id
+	}
+	ctx = context.WithValue(ctx, requestInfoContextKey{}, info)
+	if c.peer != nil {
+		ctx = context.WithValue(ctx, peerContextKey{}, c.peer)
+	}
+	return ctx
+}
+
+// extractMeta 从参数对象中取出 _meta 字段。
+func extractMeta(params json.RawMessage) json.RawMessage {
+	if len(params) == 0 {
+		return nil
+	}
+	var probe struct {
+		Meta json.RawMessage `json:"_meta"`
+	}
+	if err := json.Unmarshal(params, &probe); err != nil {
+		return nil
+	}
+	return probe.Meta
+}
@@ -0,0 +1,72 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestHandlersReachPeerThroughContext(t *testing.T) {
+	ctx := context.Background()
+
+	var info RequestInfo
+	agent := &mockAgent{cancelCh: make(chan CancelNotification, 1)}
+	agent.promptFunc = func(ctx context.Context, req PromptRequest) (PromptResponse, error) {
+		info, _ = RequestInfoFromContext(ctx)
+		client, ok := ClientFromContext(ctx)
+		if !ok {
+			t.Errorf("expected client connection in context")
+			return PromptResponse{}, InternalError()
+		}
+		if err := client.SessionNotification(ctx, SessionNotification{
+			SessionID: req.SessionID,
+			Update: SessionUpdate{
+				Type:    SessionUpdateTypeAgentMessageChunk,
+				Content: ptr(NewTextContentBlock("hello")),
+			},
+		}); err != nil {
+			return PromptResponse{}, err
+		}
+		return PromptResponse{StopReason: StopReasonEndTurn}, nil
+	}
+	client := &mockClient{sessionUpdateCh: make(chan SessionNotification, 1)}
+
+	_, clientConn := connectPair(t, agent, client, nil)
+
+	resp, err := clientConn.Prompt(ctx, PromptRequest{
+		SessionID: "sess",
+		Prompt:    []ContentBlock{NewTextContentBlock("hi")},
+		Meta:      json.RawMessage(`{"trace":"abc"}`),
+	})
+	if err != nil {
+		t.Fatalf("prompt failed: %v", err)
+	}
+	if resp.StopReason != StopReasonEndTurn {
+		t.Fatalf("unexpected stop reason %s", resp.StopReason)
+	}
+	if info.Method != AgentMethods.SessionPrompt || info.Notification || string(info.Meta) != `{"trace":"abc"}` {
+		t.Fatalf("unexpected request info %+v", info)
+	}
+	if _, ok := info.ID.AsNumber(); !ok {
+		t.Fatalf("expected numeric request id, got %+v", info.ID)
+	}
+
+	select {
+	case note := <-client.sessionUpdateCh:
+		if note.Update.Content == nil || note.Update.Content.Text != "hello" {
+			t.Fatalf("unexpected notification %+v", note)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for session notification")
+	}
+}
+
+func TestContextWithoutPeer(t *testing.T) {
+	if _, ok := PeerFromContext(context.Background()); ok {
+		t.Fatalf("expected no peer")
+	}
+	if _, ok := RequestInfoFromContext(context.Background()); ok {
+		t.Fatalf("expected no request info")
+	}
+}
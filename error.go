@@ -2,6 +2,7 @@ package acp
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 )
 
@@ -18,15 +19,36 @@ type Error struct {
 	Data    json.RawMessage `json:"data,omitempty"`
 }
 
-// Error 实现 error 接口。
+// Error 实现 error 接口，输出包含错误码；消息为空时使用注册表中的默认消息。
 func (e Error) Error() string {
-	if len(e.Message) == 0 {
-		return fmt.Sprintf("%d", e.Code)
+	message := e.Message
+	if message == "" {
+		if code, ok := LookupErrorCode(e.Code); ok {
+			message = code.Message
+		}
+	}
+	var out string
+	if message == "" {
+		out = fmt.Sprintf("code %d", e.Code)
+	} else {
+		out = fmt.Sprintf("%s (code %d)", message, e.Code)
 	}
 	if len(e.Data) == 0 {
-		return e.Message
+		return out
+	}
+	return fmt.Sprintf("%s: %s", out, string(e.Data))
+}
+
+// Is 使 errors.Is 按错误码比较，例如 errors.Is(err, ErrAuthRequired)。
+func (e Error) Is(target error) bool {
+	switch t := target.(type) {
+	case Error:
+		return e.Code == t.Code
+	case *Error:
+		return t != nil && e.Code == t.Code
+	default:
+		return false
 	}
-	return fmt.Sprintf("%s: %s", e.Message, string(e.Data))
 }
 
 // WithData 返回包含额外数据的错误拷贝。
@@ -61,6 +83,19 @@ var (
 	ErrorCodeInternalError    = ErrorCode{Code: -32603, Message: "Internal error"}
 	ErrorCodeAuthRequired     = ErrorCode{Code: -32000, Message: "Authentication required"}
 	ErrorCodeResourceNotFound = ErrorCode{Code: -32002, Message: "Resource not found"}
+	ErrorCodeTurnInProgress   = ErrorCode{Code: -32003, Message: "Prompt turn in progress"}
+)
+
+// 可用于 errors.Is 的哨兵错误，按错误码匹配。
+var (
+	ErrParseError       = NewError(ErrorCodeParseError)
+	ErrInvalidRequest   = NewError(ErrorCodeInvalidRequest)
+	ErrMethodNotFound   = NewError(ErrorCodeMethodNotFound)
+	ErrInvalidParams    = NewError(ErrorCodeInvalidParams)
+	ErrInternalError    = NewError(ErrorCodeInternalError)
+	ErrAuthRequired     = NewError(ErrorCodeAuthRequired)
+	ErrResourceNotFound = NewError(ErrorCodeResourceNotFound)
+	ErrTurnInProgress   = NewError(ErrorCodeTurnInProgress)
 )
 
 // NewError 根据错误码创建 Error。
@@ -89,11 +124,19 @@ func InternalError() Error { return NewError(ErrorCodeInternalError) }
 // AuthRequired 返回需要认证错误。
 func AuthRequired() Error { return NewError(ErrorCodeAuthRequired) }
 
+// TurnInProgress 返回会话已有进行中的 prompt 轮次错误。
+func TurnInProgress() Error { return NewError(ErrorCodeTurnInProgress) }
+
+// ResourceNotFoundData 为资源不存在错误的 data 负载。
+type ResourceNotFoundData struct {
+	URI string `json:"uri"`
+}
+
 // ResourceNotFound 返回资源不存在错误。
 func ResourceNotFound(uri *string) Error {
 	err := NewError(ErrorCodeResourceNotFound)
 	if uri != nil {
-		err = err.WithData(map[string]string{"uri": *uri})
+		err = err.WithData(ResourceNotFoundData{URI: *uri})
 	}
 	return err
 }
@@ -105,3 +148,19 @@ func IntoInternalError(err error) Error {
 	}
 	return InternalError().WithData(err.Error())
 }
+
+// ErrorMapper 将领域错误转换为协议错误，第二个返回值为 false 时按内部错误处理。
+type ErrorMapper func(error) (Error, bool)
+
+// asError 从错误链中提取 Error 或 *Error。
+func asError(err error) (Error, bool) {
+	var value Error
+	if errors.As(err, &value) {
+		return value, true
+	}
+	var ptr *Error
+	if errors.As(err, &ptr) && ptr != nil {
+		return *ptr, true
+	}
+	return Error{}, false
+}
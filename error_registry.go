@@ -0,0 +1,100 @@
+package acp
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+type registeredErrorCode struct {
+	code     ErrorCode
+	dataType reflect.Type
+}
+
+var errorRegistry = struct {
+	mu    sync.RWMutex
+	codes map[int32]registeredErrorCode
+}{
+	codes: map[int32]registeredErrorCode{},
+}
+
+func init() {
+	for _, code := range []ErrorCode{
+		ErrorCodeParseError,
+		ErrorCodeInvalidRequest,
+		ErrorCodeMethodNotFound,
+		ErrorCodeInvalidParams,
+		ErrorCodeInternalError,
+		ErrorCodeAuthRequired,
+		ErrorCodeTurnInProgress,
+	} {
+		mustRegisterErrorCode(code, nil)
+	}
+	mustRegisterErrorCode(ErrorCodeResourceNotFound, reflect.TypeOf(ResourceNotFoundData{}))
+}
+
+func mustRegisterErrorCode(code ErrorCode, dataType reflect.Type) {
+	if err := registerErrorCode(code, dataType); err != nil {
+		panic(err)
+	}
+}
+
+func registerErrorCode(code ErrorCode, dataType reflect.Type) error {
+	errorRegistry.mu.Lock()
+	defer errorRegistry.mu.Unlock()
+	if existing, ok := errorRegistry.codes[code.Code]; ok {
+		return fmt.Errorf("acp: error code %d already registered as %q", code.Code, existing.code.Message)
+	}
+	errorRegistry.codes[code.Code] = registeredErrorCode{code: code, dataType: dataType}
+	return nil
+}
+
+// RegisterErrorCode 注册应用自定义的错误码及其默认消息，错误码重复时返回错误。
+func RegisterErrorCode(code ErrorCode) error {
+	return registerErrorCode(code, nil)
+}
+
+// RegisterErrorCodeWithData 注册错误码，并声明其 data 负载的类型 T。
+func RegisterErrorCodeWithData[T any](code ErrorCode) error {
+	return registerErrorCode(code, reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// LookupErrorCode 查找已注册的错误码。
+func LookupErrorCode(code int32) (ErrorCode, bool) {
+	errorRegistry.mu.RLock()
+	defer errorRegistry.mu.RUnlock()
+	entry, ok := errorRegistry.codes[code]
+	return entry.code, ok
+}
+
+// DecodeData 按注册的负载类型解码 data；未注册类型时返回原始 json.RawMessage。
+func (e Error) DecodeData() (any, error) {
+	if len(e.Data) == 0 {
+		return nil, nil
+	}
+	errorRegistry.mu.RLock()
+	entry, ok := errorRegistry.codes[e.Code]
+	errorRegistry.mu.RUnlock()
+	if !ok || entry.dataType == nil {
+		return append(json.RawMessage(nil), e.Data...), nil
+	}
+	value := reflect.New(entry.dataType)
+	if err := json.Unmarshal(e.Data, value.Interface()); err != nil {
+		return nil, err
+	}
+	return value.Elem().Interface(), nil
+}
+
+// ErrorData 从错误链中提取 Error，并将其 data 解码为 T。
+func ErrorData[T any](err error) (T, bool) {
+	var zero T
+	acpErr, ok := asError(err)
+	if !ok || len(acpErr.Data) == 0 {
+		return zero, false
+	}
+	if err := json.Unmarshal(acpErr.Data, &zero); err != nil {
+		return zero, false
+	}
+	return zero, true
+}
@@ -2,9 +2,17 @@ package acp
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 )
 
+// unregisterErrorCode 移除已注册的错误码，用于测试结束后恢复全局注册表。
+func unregisterErrorCode(code int32) {
+	errorRegistry.mu.Lock()
+	defer errorRegistry.mu.Unlock()
+	delete(errorRegistry.codes, code)
+}
+
 func TestErrorWithData(t *testing.T) {
 	err := MethodNotFound().WithData(map[string]string{"reason": "missing"})
 	if err.Code != ErrorCodeMethodNotFound.Code {
@@ -39,3 +47,54 @@ func TestResourceNotFound(t *testing.T) {
 		t.Fatalf("expected data")
 	}
 }
+
+func TestErrorIsSentinel(t *testing.T) {
+	var received error = &Error{Code: ErrorCodeAuthRequired.Code, Message: "login first"}
+	wrapped := fmt.Errorf("prompt: %w", received)
+	if !errors.Is(wrapped, ErrAuthRequired) {
+		t.Fatalf("expected errors.Is to match auth required")
+	}
+	if errors.Is(wrapped, ErrMethodNotFound) {
+		t.Fatalf("unexpected match for method not found")
+	}
+}
+
+func TestErrorStringIncludesCode(t *testing.T) {
+	err := Error{Code: ErrorCodeInvalidParams.Code}
+	if got := err.Error(); got != "Invalid params (code -32602)" {
+		t.Fatalf("unexpected error string %q", got)
+	}
+}
+
+type quotaData struct {
+	Remaining int `json:"remaining"`
+}
+
+func TestErrorRegistry(t *testing.T) {
+	code := ErrorCode{Code: -32050, Message: "Quota exceeded"}
+	if err := RegisterErrorCodeWithData[quotaData](code); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	t.Cleanup(func() { unregisterErrorCode(code.Code) })
+	if err := RegisterErrorCode(code); err == nil {
+		t.Fatalf("expected duplicate registration to fail")
+	}
+	if got, ok := LookupErrorCode(code.Code); !ok || got.Message != code.Message {
+		t.Fatalf("unexpected lookup result %+v (ok=%v)", got, ok)
+	}
+
+	err := NewError(code).WithData(quotaData{Remaining: 3})
+	decoded, decodeErr := err.DecodeData()
+	if decodeErr != nil {
+		t.Fatalf("decode failed: %v", decodeErr)
+	}
+	if data, ok := decoded.(quotaData); !ok || data.Remaining != 3 {
+		t.Fatalf("unexpected decoded data %#v", decoded)
+	}
+
+	uri := "file:///missing"
+	data, ok := ErrorData[ResourceNotFoundData](fmt.Errorf("read: %w", ResourceNotFound(&uri)))
+	if !ok || data.URI != uri {
+		t.Fatalf("unexpected resource data %+v (ok=%v)", data, ok)
+	}
+}
@@ -0,0 +1,62 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// ExtCaller 由 AgentSideConnection 与 ClientSideConnection 实现，用于发送扩展调用。
+type ExtCaller interface {
+	ExtMethod(ctx context.Context, method string, params json.RawMessage) (ExtResponse, error)
+	ExtNotification(ctx context.Context, method string, params json.RawMessage) error
+}
+
+var (
+	_ ExtCaller = (*AgentSideConnection)(nil)
+	_ ExtCaller = (*ClientSideConnection)(nil)
+)
+
+// extMethodName 返回扩展方法在线上使用的名称，method 不应包含前导下划线。
+func extMethodName(method string) string {
+	return "_" + strings.TrimPrefix(method, "_")
+}
+
+// CallExt 以类型化的方式调用扩展方法 method。
+func CallExt[Req, Resp any](ctx context.Context, conn ExtCaller, method string, req Req) (Resp, error) {
+	var resp Resp
+	params, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+	raw, err := conn.ExtMethod(ctx, strings.TrimPrefix(method, "_"), params)
+	if err != nil {
+		return resp, err
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return resp, nil
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// NotifyExt 以类型化的方式发送扩展通知 method。
+func NotifyExt[Req any](ctx context.Context, conn ExtCaller, method string, req Req) error {
+	params, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return conn.ExtNotification(ctx, strings.TrimPrefix(method, "_"), params)
+}
+
+// RegisterExt 在 Router 上注册类型化的扩展方法处理器，优先于 Agent/Client 的 ExtMethod。
+func RegisterExt[Req, Resp any](r *Router, method string, fn func(context.Context, Req) (Resp, error)) {
+	Handle(r, extMethodName(method), fn)
+}
+
+// RegisterExtNotification 在 Router 上注册类型化的扩展通知处理器，优先于 ExtNotification。
+func RegisterExtNotification[Req any](r *Router, method string, fn func(context.Context, Req) error) {
+	HandleNotification(r, extMethodName(method), fn)
+}
@@ -0,0 +1,80 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type extCapturingAgent struct {
+	*mockAgent
+	extReq chan ExtRequest
+}
+
+func (a *extCapturingAgent) ExtMethod(_ context.Context, req ExtRequest) (ExtResponse, error) {
+	a.extReq <- req
+	return ExtResponse(json.RawMessage(`{"echo":true}`)), nil
+}
+
+type sumRequest struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+type sumResponse struct {
+	Sum int `json:"sum"`
+}
+
+func TestExtMethodsAreSymmetric(t *testing.T) {
+	ctx := context.Background()
+
+	router := NewRouter()
+	RegisterExt(router, "vendor/sum", func(_ context.Context, req sumRequest) (sumResponse, error) {
+		return sumResponse{Sum: req.A + req.B}, nil
+	})
+	notified := make(chan sumRequest, 1)
+	RegisterExtNotification(router, "vendor/log", func(_ context.Context, req sumRequest) error {
+		notified <- req
+		return nil
+	})
+
+	agent := &extCapturingAgent{
+		mockAgent: &mockAgent{cancelCh: make(chan CancelNotification, 1)},
+		extReq:    make(chan ExtRequest, 1),
+	}
+	client := &mockClient{sessionUpdateCh: make(chan SessionNotification, 1)}
+	_, clientConn := connectPair(t, agent, client, []ConnectionOption{WithRouter(router)})
+
+	if _, err := clientConn.ExtMethod(ctx, "vendor/raw", json.RawMessage(`{"value":1}`)); err != nil {
+		t.Fatalf("ext method failed: %v", err)
+	}
+	select {
+	case req := <-agent.extReq:
+		if req.Method != "vendor/raw" || string(req.Params) != `{"value":1}` {
+			t.Fatalf("unexpected ext request %+v (params=%s)", req, req.Params)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for ext request")
+	}
+
+	resp, err := CallExt[sumRequest, sumResponse](ctx, clientConn, "vendor/sum", sumRequest{A: 2, B: 3})
+	if err != nil {
+		t.Fatalf("call ext failed: %v", err)
+	}
+	if resp.Sum != 5 {
+		t.Fatalf("unexpected sum %d", resp.Sum)
+	}
+
+	if err := NotifyExt(ctx, clientConn, "vendor/log", sumRequest{A: 1}); err != nil {
+		t.Fatalf("notify ext failed: %v", err)
+	}
+	select {
+	case got := <-notified:
+		if got.A != 1 {
+			t.Fatalf("unexpected notification %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for ext notification")
+	}
+}
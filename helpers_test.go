@@ -1,6 +1,11 @@
 package acp
 
-import "encoding/json"
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+)
 
 func mustRawJSON[T any](v T) json.RawMessage {
 	data, err := json.Marshal(v)
@@ -9,3 +14,21 @@ func mustRawJSON[T any](v T) json.RawMessage {
 	}
 	return data
 }
+
+// connectPair 通过内存管道连接代理与客户端，测试结束时关闭两端。
+func connectPair(t *testing.T, agent Agent, client Client, agentOpts []ConnectionOption, clientOpts ...ConnectionOption) (*AgentSideConnection, *ClientSideConnection) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	clientToAgentReader, clientToAgentWriter := io.Pipe()
+	agentToClientReader, agentToClientWriter := io.Pipe()
+	clientConn := NewClientSideConnection(ctx, client, clientToAgentWriter, agentToClientReader, clientOpts...)
+	agentConn := NewAgentSideConnection(ctx, agent, agentToClientWriter, clientToAgentReader, agentOpts...)
+	t.Cleanup(func() {
+		cancel()
+		clientConn.Close()
+		agentConn.Close()
+		clientToAgentWriter.Close()
+		agentToClientWriter.Close()
+	})
+	return agentConn, clientConn
+}
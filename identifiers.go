@@ -1,6 +1,13 @@
 package acp
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
 
 // SessionID 会话唯一标识。
 type SessionID string
@@ -19,6 +26,8 @@ type TerminalID string
 // RequestID 支持字符串、数字与 null。
 type RequestID struct {
 	raw any
+	// text 为解码时的原始 JSON，编码时原样输出，保证回应的 ID 与对端发送的一致。
+	text string
 }
 
 // NewRequestIDNumber 创建数字 ID。
@@ -36,6 +45,9 @@ var RequestIDNull = RequestID{raw: nil}
 
 // MarshalJSON 实现 json.Marshaler。
 func (r RequestID) MarshalJSON() ([]byte, error) {
+	if r.text != "" {
+		return []byte(r.text), nil
+	}
 	switch v := r.raw.(type) {
 	case nil:
 		return []byte("null"), nil
@@ -49,22 +61,74 @@ func (r RequestID) MarshalJSON() ([]byte, error) {
 }
 
 // UnmarshalJSON 实现 json.Unmarshaler。
+//
+// 整数形式的小数（如 1.0）被视为数字 ID，对象与数组会返回错误。
+// 原始文本会被保留，再次编码时原样输出。
 func (r *RequestID) UnmarshalJSON(data []byte) error {
-	if string(data) == "null" {
+	if err := r.decode(data); err != nil {
+		return err
+	}
+	r.text = string(bytes.TrimSpace(data))
+	return nil
+}
+
+func (r *RequestID) decode(data []byte) error {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case nil:
 		r.raw = nil
-		return nil
+	case string:
+		r.raw = v
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			r.raw = n
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return fmt.Errorf("request id: %w", err)
+		}
+		if f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+			r.raw = int64(f)
+		} else {
+			r.raw = f
+		}
+	default:
+		return fmt.Errorf("request id must be a string, number or null, got %s", data)
 	}
-	var num int64
-	if err := json.Unmarshal(data, &num); err == nil {
-		r.raw = num
-		return nil
+	return nil
+}
+
+// String 返回 ID 的文本形式：数字为十进制，字符串为其本身，null 为 "null"。
+func (r RequestID) String() string {
+	switch v := r.raw.(type) {
+	case nil:
+		return "null"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
 	}
-	var str string
-	if err := json.Unmarshal(data, &str); err == nil {
-		r.raw = str
-		return nil
+}
+
+// key 返回用于关联请求与响应的规范键，使 1 与 "1" 视为同一 ID。
+func (r RequestID) key() string {
+	if s, ok := r.raw.(string); ok {
+		if n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil {
+			return strconv.FormatInt(n, 10)
+		}
+		return s
 	}
-	return json.Unmarshal(data, &r.raw)
+	return r.String()
 }
 
 // IsNull 判断是否为 null。
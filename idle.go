@@ -0,0 +1,171 @@
+package acp
+
+import (
+	"sync"
+	"time"
+)
+
+// SessionExpireFunc 在会话空闲超时后被调用。
+type SessionExpireFunc func(id SessionID)
+
+// WithSessionIdleTimeout 在代理侧启用会话空闲超时：会话在 d 内没有 prompt、cancel、
+// 模式或模型等流量时视为过期，并调用 OnSessionExpire 注册的回调。
+// 正在执行 prompt 轮次的会话不会过期。
+func WithSessionIdleTimeout(d time.Duration) ConnectionOption {
+	return func(o *connectionOptions) {
+		o.idleTimeout = d
+	}
+}
+
+// OnSessionExpire 注册会话过期回调，可多次使用。回调在计时器的 goroutine 中按注册顺序执行。
+func OnSessionExpire(fn SessionExpireFunc) ConnectionOption {
+	return func(o *connectionOptions) {
+		if fn != nil {
+			o.expireHandlers = append(o.expireHandlers, fn)
+		}
+	}
+}
+
+// idleTimer 是空闲计时器，测试中可以替换为手动触发的实现。
+type idleTimer interface {
+	Stop() bool
+}
+
+func timeAfterFunc(d time.Duration, f func()) idleTimer {
+	return time.AfterFunc(d, f)
+}
+
+// idleTracker 按会话记录最近一次活动，nil 表示未启用。
+type idleTracker struct {
+	timeout   time.Duration
+	handlers  []SessionExpireFunc
+	afterFunc func(time.Duration, func()) idleTimer
+
+	mu       sync.Mutex
+	sessions map[SessionID]*idleSession
+	stopped  bool
+}
+
+type idleSession struct {
+	timer idleTimer
+	busy  int
+	// gen 在每次重置计时器时递增，用于忽略已过时的计时器回调。
+	gen uint64
+}
+
+func newIdleTracker(opts connectionOptions) *idleTracker {
+	if opts.idleTimeout <= 0 {
+		return nil
+	}
+	afterFunc := opts.idleAfterFunc
+	if afterFunc == nil {
+		afterFunc = timeAfterFunc
+	}
+	return &idleTracker{
+		timeout:   opts.idleTimeout,
+		handlers:  opts.expireHandlers,
+		afterFunc: afterFunc,
+		sessions:  make(map[SessionID]*idleSession),
+	}
+}
+
+// touch 记录会话活动并重新计时，会话未被跟踪时开始跟踪。
+func (t *idleTracker) touch(id SessionID) {
+	if t == nil || id == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	s := t.sessions[id]
+	if s == nil {
+		s = &idleSession{}
+		t.sessions[id] = s
+	}
+	t.reset(id, s)
+}
+
+// touchKnown 仅对已跟踪的会话记录活动。
+func (t *idleTracker) touchKnown(id SessionID) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	_, ok := t.sessions[id]
+	t.mu.Unlock()
+	if ok {
+		t.touch(id)
+	}
+}
+
+// begin 标记已跟踪的会话开始一个 prompt 轮次，返回的函数在轮次结束时调用。
+// 未跟踪的会话（包括已过期的会话）不会因 prompt 重新开始跟踪。
+func (t *idleTracker) begin(id SessionID) func() {
+	if t == nil {
+		return func() {}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.sessions[id]
+	if s == nil {
+		return func() {}
+	}
+	s.busy++
+	s.gen++
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		s.busy--
+		if t.sessions[id] == s && !t.stopped {
+			t.reset(id, s)
+		}
+	}
+}
+
+// reset 重新启动会话计时器，调用方需持有 mu。
+func (t *idleTracker) reset(id SessionID, s *idleSession) {
+	s.gen++
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	if s.busy > 0 {
+		return
+	}
+	gen := s.gen
+	s.timer = t.afterFunc(t.timeout, func() { t.expire(id, gen) })
+}
+
+func (t *idleTracker) expire(id SessionID, gen uint64) {
+	t.mu.Lock()
+	s := t.sessions[id]
+	if t.stopped || s == nil || s.gen != gen || s.busy > 0 {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.sessions, id)
+	t.mu.Unlock()
+	for _, fn := range t.handlers {
+		fn(id)
+	}
+}
+
+// stop 在连接关闭时停止所有计时器，之后不会再触发过期回调。
+func (t *idleTracker) stop() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+	for _, s := range t.sessions {
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+	}
+	t.sessions = map[SessionID]*idleSession{}
+}
@@ -0,0 +1,199 @@
+package acp
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIdleClock 记录创建的计时器，由测试调用 fire 模拟超时。
+type fakeIdleClock struct {
+	mu     sync.Mutex
+	timers []*fakeIdleTimer
+}
+
+type fakeIdleTimer struct {
+	clock   *fakeIdleClock
+	fn      func()
+	stopped bool
+}
+
+func (c *fakeIdleClock) afterFunc(_ time.Duration, fn func()) idleTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	timer := &fakeIdleTimer{clock: c, fn: fn}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+func (t *fakeIdleTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	wasActive := !t.stopped
+	t.stopped = true
+	return wasActive
+}
+
+// fire 触发所有未停止的计时器并返回触发的个数。
+func (c *fakeIdleClock) fire() int {
+	c.mu.Lock()
+	var due []func()
+	for _, timer := range c.timers {
+		if !timer.stopped {
+			timer.stopped = true
+			due = append(due, timer.fn)
+		}
+	}
+	c.mu.Unlock()
+	for _, fn := range due {
+		fn()
+	}
+	return len(due)
+}
+
+func withIdleClock(clock *fakeIdleClock) ConnectionOption {
+	return func(o *connectionOptions) {
+		o.idleAfterFunc = clock.afterFunc
+	}
+}
+
+func newTestIdleTracker(clock *fakeIdleClock, expired chan<- SessionID) *idleTracker {
+	return newIdleTracker(newConnectionOptions([]ConnectionOption{
+		WithSessionIdleTimeout(time.Minute),
+		OnSessionExpire(func(id SessionID) { expired <- id }),
+		withIdleClock(clock),
+	}))
+}
+
+func TestSessionIdleExpiry(t *testing.T) {
+	expired := make(chan SessionID, 1)
+	agent := &mockAgent{
+		newSessionFunc: func(context.Context, NewSessionRequest) (NewSessionResponse, error) {
+			return NewSessionResponse{SessionID: "s1"}, nil
+		},
+	}
+	_, clientConn := connectPair(t, agent, &mockClient{}, []ConnectionOption{
+		WithSessionIdleTimeout(50 * time.Millisecond),
+		OnSessionExpire(func(id SessionID) { expired <- id }),
+	})
+
+	if _, err := clientConn.NewSession(context.Background(), NewSessionRequest{CWD: "/"}); err != nil {
+		t.Fatalf("new session failed: %v", err)
+	}
+	select {
+	case id := <-expired:
+		if id != "s1" {
+			t.Fatalf("unexpected expired session %q", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("session did not expire")
+	}
+}
+
+func TestPromptKeepsSessionAlive(t *testing.T) {
+	clock := &fakeIdleClock{}
+	expired := make(chan SessionID, 1)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	agent := &mockAgent{
+		newSessionFunc: func(context.Context, NewSessionRequest) (NewSessionResponse, error) {
+			return NewSessionResponse{SessionID: "s1"}, nil
+		},
+		promptFunc: func(context.Context, PromptRequest) (PromptResponse, error) {
+			close(started)
+			<-release
+			return PromptResponse{StopReason: StopReasonEndTurn}, nil
+		},
+	}
+	_, clientConn := connectPair(t, agent, &mockClient{}, []ConnectionOption{
+		WithSessionIdleTimeout(time.Minute),
+		OnSessionExpire(func(id SessionID) { expired <- id }),
+		withIdleClock(clock),
+	})
+	ctx := context.Background()
+	if _, err := clientConn.NewSession(ctx, NewSessionRequest{CWD: "/"}); err != nil {
+		t.Fatalf("new session failed: %v", err)
+	}
+	result := promptAsync(clientConn, "s1", "hi")
+	<-started
+	if n := clock.fire(); n != 0 {
+		t.Fatalf("%d idle timers were running during the prompt turn", n)
+	}
+	close(release)
+	if res := <-result; res.err != nil {
+		t.Fatalf("prompt failed: %v", res.err)
+	}
+	select {
+	case id := <-expired:
+		t.Fatalf("session %q expired during prompt turn", id)
+	default:
+	}
+	clock.fire()
+	select {
+	case <-expired:
+	default:
+		t.Fatal("session did not expire after prompt turn")
+	}
+}
+
+func TestIdleTrackerTouchResetsTimer(t *testing.T) {
+	clock := &fakeIdleClock{}
+	expired := make(chan SessionID, 2)
+	tracker := newTestIdleTracker(clock, expired)
+	tracker.touch("s")
+	for i := 0; i < 5; i++ {
+		tracker.touchKnown("s")
+	}
+	tracker.touchKnown("unknown")
+	if n := clock.fire(); n != 1 {
+		t.Fatalf("expected only the latest timer to fire, fired %d", n)
+	}
+	if id := <-expired; id != "s" {
+		t.Fatalf("unexpected expired session %q", id)
+	}
+	select {
+	case id := <-expired:
+		t.Fatalf("untracked session %q should not expire", id)
+	default:
+	}
+}
+
+func TestIdlePromptDoesNotReviveExpiredSession(t *testing.T) {
+	clock := &fakeIdleClock{}
+	expired := make(chan SessionID, 2)
+	tracker := newTestIdleTracker(clock, expired)
+	tracker.touch("s")
+	clock.fire()
+	<-expired
+
+	tracker.begin("s")()
+	tracker.begin("never-created")()
+	if n := clock.fire(); n != 0 {
+		t.Fatalf("prompt restarted %d idle timers for untracked sessions", n)
+	}
+	if len(tracker.sessions) != 0 {
+		t.Fatalf("expected no tracked sessions, got %v", tracker.sessions)
+	}
+}
+
+func TestIdleTrackerStop(t *testing.T) {
+	clock := &fakeIdleClock{}
+	expired := make(chan SessionID, 1)
+	tracker := newTestIdleTracker(clock, expired)
+	tracker.touch("s")
+	tracker.stop()
+	tracker.touch("s")
+	if n := clock.fire(); n != 0 {
+		t.Fatalf("%d timers fired after stop", n)
+	}
+	select {
+	case id := <-expired:
+		t.Fatalf("session %q expired after stop", id)
+	default:
+	}
+
+	if newIdleTracker(connectionOptions{}) != nil {
+		t.Fatal("tracker should be disabled without a timeout")
+	}
+}
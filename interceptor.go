@@ -0,0 +1,57 @@
+package acp
+
+import "context"
+
+// CallInfo 描述一次经过拦截器的调用。
+type CallInfo struct {
+	Method       string
+	Notification bool
+	Direction    StreamMessageDirection
+}
+
+// Invoker 执行调用链中的下一步。
+//
+// 入站调用的 params 为解码后的请求类型（例如 PromptRequest），返回值为处理器的响应；
+// 出站调用的 params 为传给连接方法的请求值，返回值为对端响应的原始 JSON。
+// 通知的返回值总为 nil。
+type Invoker func(ctx context.Context, params any) (any, error)
+
+// UnaryInterceptor 拦截一次调用，可在调用 next 前后执行逻辑，或直接返回而不调用 next。
+// 传给 next 的 params 必须与收到的类型相同。
+type UnaryInterceptor func(ctx context.Context, info CallInfo, params any, next Invoker) (any, error)
+
+// WithInboundInterceptors 为入站请求与通知安装拦截器，先安装的位于外层。
+func WithInboundInterceptors(interceptors ...UnaryInterceptor) ConnectionOption {
+	return func(o *connectionOptions) {
+		o.inbound = append(o.inbound, interceptors...)
+	}
+}
+
+// WithOutboundInterceptors 为出站请求与通知安装拦截器，先安装的位于外层。
+func WithOutboundInterceptors(interceptors ...UnaryInterceptor) ConnectionOption {
+	return func(o *connectionOptions) {
+		o.outbound = append(o.outbound, interceptors...)
+	}
+}
+
+// chainInterceptors 将拦截器组合为单个 Invoker。
+func chainInterceptors(interceptors []UnaryInterceptor, info CallInfo, final Invoker) Invoker {
+	next := final
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := interceptors[i], next
+		next = func(ctx context.Context, params any) (any, error) {
+			return interceptor(ctx, info, params, inner)
+		}
+	}
+	return next
+}
+
+func (o connectionOptions) interceptInbound(ctx context.Context, info CallInfo, params any, call Invoker) (any, error) {
+	info.Direction = StreamIncoming
+	return chainInterceptors(o.inbound, info, call)(ctx, params)
+}
+
+func (o connectionOptions) interceptOutbound(ctx context.Context, info CallInfo, params any, call Invoker) (any, error) {
+	info.Direction = StreamOutgoing
+	return chainInterceptors(o.outbound, info, call)(ctx, params)
+}
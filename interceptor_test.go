@@ -0,0 +1,133 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestInboundInterceptorSeesDecodedParams(t *testing.T) {
+	var order []string
+	record := func(name string) UnaryInterceptor {
+		return func(ctx context.Context, info CallInfo, params any, next Invoker) (any, error) {
+			order = append(order, name+":"+info.Method)
+			return next(ctx, params)
+		}
+	}
+	var seen any
+	capture := func(ctx context.Context, info CallInfo, params any, next Invoker) (any, error) {
+		seen = params
+		return next(ctx, params)
+	}
+	handler := &agentInboundHandler{
+		agent: &testAgent{},
+		opts:  newConnectionOptions([]ConnectionOption{WithInboundInterceptors(record("outer"), record("inner"), capture)}),
+	}
+
+	resp, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.Initialize, mustRawJSON(InitializeRequest{ProtocolVersion: ProtocolVersionV1}))
+	if errObj.Code != 0 {
+		t.Fatalf("unexpected error: %+v", errObj)
+	}
+	if _, ok := resp.(InitializeResponse); !ok {
+		t.Fatalf("unexpected response type %T", resp)
+	}
+	if _, ok := seen.(InitializeRequest); !ok {
+		t.Fatalf("expected decoded params, got %T", seen)
+	}
+	if len(order) != 2 || order[0] != "outer:initialize" || order[1] != "inner:initialize" {
+		t.Fatalf("unexpected interceptor order %v", order)
+	}
+}
+
+func TestInboundInterceptorShortCircuits(t *testing.T) {
+	agent := &testAgent{}
+	deny := func(ctx context.Context, info CallInfo, params any, next Invoker) (any, error) {
+		if info.Notification {
+			return nil, nil
+		}
+		return nil, AuthRequired()
+	}
+	handler := &agentInboundHandler{
+		agent: agent,
+		opts:  newConnectionOptions([]ConnectionOption{WithInboundInterceptors(deny)}),
+	}
+	_, errObj, _ := handler.handleRequest(context.Background(), "_ext", mustRawJSON(map[string]string{"a": "b"}))
+	if errObj.Code != ErrorCodeAuthRequired.Code {
+		t.Fatalf("expected auth required, got %+v", errObj)
+	}
+	if agent.extMethodCalled {
+		t.Fatalf("expected ext method to be skipped")
+	}
+	handler.handleNotification(context.Background(), AgentMethods.SessionCancel, mustRawJSON(CancelNotification{SessionID: "sess"}))
+	if agent.cancelCalled {
+		t.Fatalf("expected cancel to be skipped")
+	}
+}
+
+func TestOutboundInterceptor(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var calls []CallInfo
+	var results []any
+	audit := func(ctx context.Context, info CallInfo, params any, next Invoker) (any, error) {
+		result, err := next(ctx, params)
+		mu.Lock()
+		calls = append(calls, info)
+		results = append(results, result)
+		mu.Unlock()
+		return result, err
+	}
+	errBlocked := errors.New("blocked")
+	block := func(ctx context.Context, info CallInfo, params any, next Invoker) (any, error) {
+		if info.Method == AgentMethods.SessionCancel {
+			return nil, errBlocked
+		}
+		return next(ctx, params)
+	}
+
+	agent := &mockAgent{cancelCh: make(chan CancelNotification, 1)}
+	client := &mockClient{sessionUpdateCh: make(chan SessionNotification, 1)}
+	_, clientConn := connectPair(t, agent, client, nil, WithOutboundInterceptors(audit, block))
+
+	if _, err := clientConn.Initialize(ctx, InitializeRequest{ProtocolVersion: ProtocolVersionV1}); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	if err := clientConn.Cancel(ctx, CancelNotification{SessionID: "sess"}); !errors.Is(err, errBlocked) {
+		t.Fatalf("expected blocked error, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 2 {
+		t.Fatalf("unexpected calls %+v", calls)
+	}
+	if calls[0].Method != AgentMethods.Initialize || calls[0].Direction != StreamOutgoing || calls[0].Notification {
+		t.Fatalf("unexpected call info %+v", calls[0])
+	}
+	if results[0] == nil {
+		t.Fatalf("expected initialize result to be visible")
+	}
+	if !calls[1].Notification {
+		t.Fatalf("expected cancel to be a notification")
+	}
+}
+
+func TestOutboundInterceptorTypedResult(t *testing.T) {
+	cached := func(ctx context.Context, info CallInfo, params any, next Invoker) (any, error) {
+		if info.Method == AgentMethods.SessionNew {
+			return NewSessionResponse{SessionID: "cached"}, nil
+		}
+		return next(ctx, params)
+	}
+	_, clientConn := connectPair(t, &mockAgent{}, &mockClient{}, nil, WithOutboundInterceptors(cached))
+
+	resp, err := clientConn.NewSession(context.Background(), NewSessionRequest{CWD: "/tmp"})
+	if err != nil {
+		t.Fatalf("new session failed: %v", err)
+	}
+	if resp.SessionID != "cached" {
+		t.Fatalf("typed interceptor result was dropped: %+v", resp)
+	}
+}
@@ -0,0 +1,134 @@
+package acp
+
+import "sync"
+
+// ConnectionState 表示连接的生命周期状态。
+type ConnectionState int32
+
+// ConnectionState 枚举，按生命周期先后排列。
+const (
+	StateUninitialized ConnectionState = iota
+	StateInitialized
+	StateAuthenticated
+	StateClosed
+)
+
+// String 实现 fmt.Stringer。
+func (s ConnectionState) String() string {
+	switch s {
+	case StateUninitialized:
+		return "uninitialized"
+	case StateInitialized:
+		return "initialized"
+	case StateAuthenticated:
+		return "authenticated"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// StateChangeFunc 在连接状态变化后被调用。
+type StateChangeFunc func(from, to ConnectionState)
+
+// WithStateChangeHandler 注册状态变化回调，可多次使用。
+func WithStateChangeHandler(fn StateChangeFunc) ConnectionOption {
+	return func(o *connectionOptions) {
+		if fn != nil {
+			o.stateHandlers = append(o.stateHandlers, fn)
+		}
+	}
+}
+
+// WithLifecycleEnforcement 要求 initialize 必须是第一个且只能调用一次的方法，
+// 违反顺序的入站与出站调用都会得到 InvalidRequest。
+func WithLifecycleEnforcement() ConnectionOption {
+	return func(o *connectionOptions) {
+		o.enforceLifecycle = true
+	}
+}
+
+// connectionLifecycle 记录连接状态，状态只会向后迁移。
+type connectionLifecycle struct {
+	mu    sync.Mutex
+	state ConnectionState
+	// initializing 表示已有 initialize 在进行中，启用生命周期约束时用于拒绝并发的 initialize。
+	initializing bool
+}
+
+func (l *connectionLifecycle) State() ConnectionState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state
+}
+
+// advance 在 to 晚于当前状态时迁移，并依次调用回调。
+func (l *connectionLifecycle) advance(to ConnectionState, handlers []StateChangeFunc) {
+	l.mu.Lock()
+	from, ok := l.advanceLocked(to)
+	l.mu.Unlock()
+	if ok {
+		notifyStateChange(handlers, from, to)
+	}
+}
+
+// advanceLocked 在持有 mu 时迁移状态，返回原状态与是否发生迁移。
+func (l *connectionLifecycle) advanceLocked(to ConnectionState) (ConnectionState, bool) {
+	from := l.state
+	if to <= from {
+		return from, false
+	}
+	l.state = to
+	return from, true
+}
+
+func notifyStateChange(handlers []StateChangeFunc, from, to ConnectionState) {
+	for _, fn := range handlers {
+		fn(from, to)
+	}
+}
+
+// beginInitialize 在同一把锁内校验并占用 initialize。返回的函数以调用是否成功结束占用：
+// 成功时迁移到 StateInitialized，失败时回滚，之后可以重新 initialize。
+func (l *connectionLifecycle) beginInitialize(opts connectionOptions) (func(ok bool), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if opts.enforceLifecycle {
+		switch {
+		case l.state == StateClosed:
+			return nil, InvalidRequest().WithData("connection closed")
+		case l.state != StateUninitialized || l.initializing:
+			return nil, InvalidRequest().WithData("connection already initialized")
+		}
+		l.initializing = true
+	}
+	return func(ok bool) {
+		l.mu.Lock()
+		l.initializing = false
+		var from ConnectionState
+		changed := false
+		if ok {
+			from, changed = l.advanceLocked(StateInitialized)
+		}
+		l.mu.Unlock()
+		if changed {
+			notifyStateChange(opts.stateHandlers, from, StateInitialized)
+		}
+	}, nil
+}
+
+// check 校验 initialize 以外的调用是否符合生命周期约束。
+func (l *connectionLifecycle) check(opts connectionOptions) error {
+	if !opts.enforceLifecycle {
+		return nil
+	}
+	switch state := l.State(); state {
+	case StateClosed:
+		return InvalidRequest().WithData("connection closed")
+	case StateUninitialized:
+		return InvalidRequest().WithData("initialize must be called first")
+	default:
+		return nil
+	}
+}
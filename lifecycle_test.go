@@ -0,0 +1,160 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAgentLifecycleEnforcement(t *testing.T) {
+	var transitions []ConnectionState
+	handler := &agentInboundHandler{
+		agent: &testAgent{},
+		opts: newConnectionOptions([]ConnectionOption{
+			WithLifecycleEnforcement(),
+			WithStateChangeHandler(func(_, to ConnectionState) {
+				transitions = append(transitions, to)
+			}),
+		}),
+	}
+
+	_, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.SessionPrompt, mustRawJSON(PromptRequest{SessionID: "sess"}))
+	if errObj.Code != ErrorCodeInvalidRequest.Code {
+		t.Fatalf("expected invalid request before initialize, got %+v", errObj)
+	}
+
+	init := mustRawJSON(InitializeRequest{ProtocolVersion: ProtocolVersionV1})
+	if _, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.Initialize, init); errObj.Code != 0 {
+		t.Fatalf("unexpected initialize error: %+v", errObj)
+	}
+	if state := handler.lifecycle.State(); state != StateInitialized {
+		t.Fatalf("unexpected state %s", state)
+	}
+	if _, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.Initialize, init); errObj.Code != ErrorCodeInvalidRequest.Code {
+		t.Fatalf("expected invalid request for second initialize, got %+v", errObj)
+	}
+
+	handler.handleClose(io.EOF)
+	if len(transitions) != 2 || transitions[0] != StateInitialized || transitions[1] != StateClosed {
+		t.Fatalf("unexpected transitions %v", transitions)
+	}
+}
+
+func TestAgentLifecycleNotEnforcedByDefault(t *testing.T) {
+	handler := &agentInboundHandler{agent: &testAgent{}}
+	_, errObj, _ := handler.handleRequest(context.Background(), "_ext", mustRawJSON(map[string]string{}))
+	if errObj.Code != 0 {
+		t.Fatalf("unexpected error: %+v", errObj)
+	}
+}
+
+func TestClientLifecycleState(t *testing.T) {
+	ctx := context.Background()
+
+	agent := &mockAgent{cancelCh: make(chan CancelNotification, 1)}
+	agent.initializeFunc = func(context.Context, InitializeRequest) (InitializeResponse, error) {
+		return InitializeResponse{AuthMethods: []AuthMethod{{ID: "token", Name: "Token"}}}, nil
+	}
+	client := &mockClient{sessionUpdateCh: make(chan SessionNotification, 1)}
+	agentConn, clientConn := connectPair(t, agent, client, []ConnectionOption{WithLifecycleEnforcement()}, WithLifecycleEnforcement())
+
+	if _, err := clientConn.NewSession(ctx, NewSessionRequest{CWD: "/tmp"}); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("expected local invalid request, got %v", err)
+	}
+	if err := agentConn.SessionNotification(ctx, SessionNotification{SessionID: "sess"}); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("expected agent outbound to be refused, got %v", err)
+	}
+
+	if _, err := clientConn.Initialize(ctx, InitializeRequest{ProtocolVersion: ProtocolVersionV1}); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	if clientConn.State() != StateInitialized || agentConn.State() != StateInitialized {
+		t.Fatalf("unexpected states client=%s agent=%s", clientConn.State(), agentConn.State())
+	}
+	if _, err := clientConn.Authenticate(ctx, AuthenticateRequest{MethodID: "token"}); err != nil {
+		t.Fatalf("authenticate failed: %v", err)
+	}
+	if clientConn.State() != StateAuthenticated || agentConn.State() != StateAuthenticated {
+		t.Fatalf("unexpected states client=%s agent=%s", clientConn.State(), agentConn.State())
+	}
+
+	clientConn.Close()
+	if clientConn.State() != StateClosed {
+		t.Fatalf("expected closed state, got %s", clientConn.State())
+	}
+}
+
+func TestConcurrentInitializeRunsOnce(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	agent := &mockAgent{initializeFunc: func(context.Context, InitializeRequest) (InitializeResponse, error) {
+		calls.Add(1)
+		<-release
+		return InitializeResponse{}, nil
+	}}
+	handler := &agentInboundHandler{agent: agent, opts: newConnectionOptions([]ConnectionOption{WithLifecycleEnforcement()})}
+	init := mustRawJSON(InitializeRequest{ProtocolVersion: ProtocolVersionV1})
+
+	var wg sync.WaitGroup
+	errs := make(chan Error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.Initialize, init)
+			errs <- errObj
+		}()
+	}
+	// 第二个 initialize 在第一个仍在执行时就会被拒绝。
+	if errObj := <-errs; errObj.Code != ErrorCodeInvalidRequest.Code {
+		t.Fatalf("expected concurrent initialize to be rejected, got %+v", errObj)
+	}
+	close(release)
+	wg.Wait()
+	if errObj := <-errs; errObj.Code != 0 {
+		t.Fatalf("unexpected initialize error: %+v", errObj)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("agent initialized %d times", calls.Load())
+	}
+}
+
+func TestFailedInitializeRollsBack(t *testing.T) {
+	fail := true
+	agent := &mockAgent{initializeFunc: func(context.Context, InitializeRequest) (InitializeResponse, error) {
+		if fail {
+			return InitializeResponse{}, InternalError()
+		}
+		return InitializeResponse{}, nil
+	}}
+	handler := &agentInboundHandler{agent: agent, opts: newConnectionOptions([]ConnectionOption{WithLifecycleEnforcement()})}
+	init := mustRawJSON(InitializeRequest{ProtocolVersion: ProtocolVersionV1})
+
+	if _, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.Initialize, init); errObj.Code != ErrorCodeInternalError.Code {
+		t.Fatalf("expected initialize to fail, got %+v", errObj)
+	}
+	if state := handler.lifecycle.State(); state != StateUninitialized {
+		t.Fatalf("failed initialize left state %s", state)
+	}
+	fail = false
+	if _, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.Initialize, init); errObj.Code != 0 {
+		t.Fatalf("retry after failed initialize was rejected: %+v", errObj)
+	}
+}
+
+func TestAuthenticateWithoutAuthMethodsKeepsState(t *testing.T) {
+	handler := &agentInboundHandler{agent: &mockAgent{}}
+	init := mustRawJSON(InitializeRequest{ProtocolVersion: ProtocolVersionV1})
+	if _, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.Initialize, init); errObj.Code != 0 {
+		t.Fatalf("unexpected initialize error: %+v", errObj)
+	}
+	if _, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.Authenticate, mustRawJSON(AuthenticateRequest{MethodID: "none"})); errObj.Code != 0 {
+		t.Fatalf("unexpected authenticate error: %+v", errObj)
+	}
+	if state := handler.lifecycle.State(); state != StateInitialized {
+		t.Fatalf("authenticate without advertised methods moved state to %s", state)
+	}
+}
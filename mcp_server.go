@@ -0,0 +1,242 @@
+package acp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// McpServer MCP 服务配置，是 stdio、HTTP 与 SSE 三种配置的联合类型。
+//
+// 三个字段中有且仅有一个非 nil。stdio 变体在线上格式中不携带 type 字段。
+type McpServer struct {
+	Stdio *McpServerStdio
+	HTTP  *McpServerHTTP
+	SSE   *McpServerSSE
+}
+
+// McpServerStdio 通过子进程标准输入输出连接的 MCP 服务。
+type McpServerStdio struct {
+	Name    string          `json:"name"`
+	Command string          `json:"command"`
+	Args    []string        `json:"args"`
+	Env     []EnvVariable   `json:"env"`
+	Meta    json.RawMessage `json:"_meta,omitempty"`
+}
+
+// McpServerHTTP 通过 HTTP 连接的 MCP 服务。
+type McpServerHTTP struct {
+	Name    string          `json:"name"`
+	URL     string          `json:"url"`
+	Headers []HttpHeader    `json:"headers"`
+	Meta    json.RawMessage `json:"_meta,omitempty"`
+}
+
+// McpServerSSE 通过 SSE 连接的 MCP 服务。
+type McpServerSSE struct {
+	Name    string          `json:"name"`
+	URL     string          `json:"url"`
+	Headers []HttpHeader    `json:"headers"`
+	Meta    json.RawMessage `json:"_meta,omitempty"`
+}
+
+// NewMcpServerStdio 创建 stdio 服务配置。
+func NewMcpServerStdio(server McpServerStdio) McpServer {
+	return McpServer{Stdio: &server}
+}
+
+// NewMcpServerHTTP 创建 HTTP 服务配置。
+func NewMcpServerHTTP(server McpServerHTTP) McpServer {
+	return McpServer{HTTP: &server}
+}
+
+// NewMcpServerSSE 创建 SSE 服务配置。
+func NewMcpServerSSE(server McpServerSSE) McpServer {
+	return McpServer{SSE: &server}
+}
+
+// Type 返回服务类型，未设置任何变体时返回空字符串。
+func (s McpServer) Type() McpServerType {
+	switch {
+	case s.Stdio != nil:
+		return McpServerTypeStdio
+	case s.HTTP != nil:
+		return McpServerTypeHTTP
+	case s.SSE != nil:
+		return McpServerTypeSSE
+	default:
+		return ""
+	}
+}
+
+// Name 返回服务名称。
+func (s McpServer) Name() string {
+	switch {
+	case s.Stdio != nil:
+		return s.Stdio.Name
+	case s.HTTP != nil:
+		return s.HTTP.Name
+	case s.SSE != nil:
+		return s.SSE.Name
+	default:
+		return ""
+	}
+}
+
+// Validate 校验配置是否完整。
+func (s McpServer) Validate() error {
+	set := 0
+	for _, ok := range []bool{s.Stdio != nil, s.HTTP != nil, s.SSE != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("mcp server: exactly one of stdio, http or sse must be set")
+	}
+	switch {
+	case s.Stdio != nil:
+		return s.Stdio.Validate()
+	case s.HTTP != nil:
+		return s.HTTP.Validate()
+	default:
+		return s.SSE.Validate()
+	}
+}
+
+// Validate 校验 stdio 配置。
+func (s McpServerStdio) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("mcp server: name must not be empty")
+	}
+	if s.Command == "" {
+		return fmt.Errorf("mcp server %q: command must not be empty", s.Name)
+	}
+	for _, env := range s.Env {
+		if env.Name == "" {
+			return fmt.Errorf("mcp server %q: env variable name must not be empty", s.Name)
+		}
+	}
+	return nil
+}
+
+// Validate 校验 HTTP 配置。
+func (s McpServerHTTP) Validate() error {
+	return validateRemoteMcpServer(s.Name, s.URL, s.Headers)
+}
+
+// Validate 校验 SSE 配置。
+func (s McpServerSSE) Validate() error {
+	return validateRemoteMcpServer(s.Name, s.URL, s.Headers)
+}
+
+func validateRemoteMcpServer(name, rawURL string, headers []HttpHeader) error {
+	if name == "" {
+		return fmt.Errorf("mcp server: name must not be empty")
+	}
+	if rawURL == "" {
+		return fmt.Errorf("mcp server %q: url must not be empty", name)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("mcp server %q: invalid url: %w", name, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("mcp server %q: url must be absolute", name)
+	}
+	for _, header := range headers {
+		if header.Name == "" {
+			return fmt.Errorf("mcp server %q: header name must not be empty", name)
+		}
+	}
+	return nil
+}
+
+// MarshalJSON 实现 json.Marshaler。
+func (s McpServer) MarshalJSON() ([]byte, error) {
+	switch {
+	case s.Stdio != nil:
+		server := *s.Stdio
+		if server.Args == nil {
+			server.Args = []string{}
+		}
+		if server.Env == nil {
+			server.Env = []EnvVariable{}
+		}
+		return json.Marshal(server)
+	case s.HTTP != nil:
+		server := *s.HTTP
+		if server.Headers == nil {
+			server.Headers = []HttpHeader{}
+		}
+		return json.Marshal(struct {
+			Type McpServerType `json:"type"`
+			McpServerHTTP
+		}{McpServerTypeHTTP, server})
+	case s.SSE != nil:
+		server := *s.SSE
+		if server.Headers == nil {
+			server.Headers = []HttpHeader{}
+		}
+		return json.Marshal(struct {
+			Type McpServerType `json:"type"`
+			McpServerSSE
+		}{McpServerTypeSSE, server})
+	default:
+		return nil, fmt.Errorf("mcp server: no variant set")
+	}
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler，缺少 type 字段时视为 stdio。
+func (s *McpServer) UnmarshalJSON(data []byte) error {
+	var probe struct {
+		Type McpServerType `json:"type"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return err
+	}
+	*s = McpServer{}
+	switch probe.Type {
+	case "", McpServerTypeStdio:
+		var server McpServerStdio
+		if err := json.Unmarshal(data, &server); err != nil {
+			return err
+		}
+		s.Stdio = &server
+	case McpServerTypeHTTP:
+		var server McpServerHTTP
+		if err := json.Unmarshal(data, &server); err != nil {
+			return err
+		}
+		s.HTTP = &server
+	case McpServerTypeSSE:
+		var server McpServerSSE
+		if err := json.Unmarshal(data, &server); err != nil {
+			return err
+		}
+		s.SSE = &server
+	default:
+		return fmt.Errorf("mcp server: unknown type %q", probe.Type)
+	}
+	return nil
+}
+
+// checkMcpServers 校验服务配置，并确认 HTTP/SSE 类型已在能力中声明。
+func checkMcpServers(servers []McpServer, caps McpCapabilities) error {
+	for i, server := range servers {
+		if err := server.Validate(); err != nil {
+			return fmt.Errorf("mcpServers[%d]: %w", i, err)
+		}
+		switch server.Type() {
+		case McpServerTypeHTTP:
+			if !caps.HTTP {
+				return fmt.Errorf("mcpServers[%d]: http transport is not supported by this agent", i)
+			}
+		case McpServerTypeSSE:
+			if !caps.SSE {
+				return fmt.Errorf("mcpServers[%d]: sse transport is not supported by this agent", i)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestMcpServerStdioOmitsType(t *testing.T) {
+	server := NewMcpServerStdio(McpServerStdio{Name: "fs", Command: "/usr/bin/mcp-fs"})
+	data, err := json.Marshal(server)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if string(data) != `{"name":"fs","command":"/usr/bin/mcp-fs","args":[],"env":[]}` {
+		t.Fatalf("unexpected json %s", data)
+	}
+
+	var decoded McpServer
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if decoded.Type() != McpServerTypeStdio || decoded.Stdio.Command != "/usr/bin/mcp-fs" {
+		t.Fatalf("unexpected server %+v", decoded)
+	}
+}
+
+func TestMcpServerHTTPRoundtrip(t *testing.T) {
+	server := NewMcpServerHTTP(McpServerHTTP{
+		Name:    "remote",
+		URL:     "https://example.com/mcp",
+		Headers: []HttpHeader{{Name: "Authorization", Value: "Bearer x"}},
+	})
+	data, err := json.Marshal(server)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	var decoded McpServer
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if decoded.HTTP == nil || decoded.HTTP.URL != "https://example.com/mcp" || len(decoded.HTTP.Headers) != 1 {
+		t.Fatalf("unexpected server %+v", decoded)
+	}
+	if err := decoded.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+}
+
+func TestMcpServerUnknownType(t *testing.T) {
+	var decoded McpServer
+	if err := json.Unmarshal([]byte(`{"type":"ws","name":"x"}`), &decoded); err == nil {
+		t.Fatalf("expected error for unknown type")
+	}
+}
+
+func TestMcpServerValidate(t *testing.T) {
+	cases := []McpServer{
+		{},
+		NewMcpServerHTTP(McpServerHTTP{Name: "remote"}),
+		NewMcpServerSSE(McpServerSSE{Name: "remote", URL: "/relative"}),
+		NewMcpServerStdio(McpServerStdio{Name: "local"}),
+		{Stdio: &McpServerStdio{Name: "a", Command: "a"}, HTTP: &McpServerHTTP{Name: "b", URL: "http://b"}},
+	}
+	for i, server := range cases {
+		if err := server.Validate(); err == nil {
+			t.Fatalf("case %d: expected validation error", i)
+		}
+	}
+}
+
+func TestAgentInboundRejectsUnadvertisedMcpTransport(t *testing.T) {
+	agent := &testAgent{}
+	handler := &agentInboundHandler{agent: agent}
+	params := mustRawJSON(NewSessionRequest{
+		CWD: "/tmp",
+		McpServers: []McpServer{
+			NewMcpServerSSE(McpServerSSE{Name: "remote", URL: "https://example.com/sse"}),
+		},
+	})
+
+	_, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.SessionNew, params)
+	if errObj.Code != ErrorCodeInvalidParams.Code {
+		t.Fatalf("expected invalid params, got %+v", errObj)
+	}
+
+	handler.agentCapabilities.McpCapabilities.SSE = true
+	_, errObj, _ = handler.handleRequest(context.Background(), AgentMethods.SessionNew, params)
+	if errObj.Code == ErrorCodeInvalidParams.Code {
+		t.Fatalf("unexpected invalid params: %+v", errObj)
+	}
+}
@@ -0,0 +1,172 @@
+package acp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ModeRegistry 声明代理可用的模式与模型，并按会话记录当前选择。
+//
+// SetSessionMode 与 SetSessionModel 的签名与 Agent 相同，可以直接委托；
+// 代理主动切换模式时使用 ChangeMode，它会向客户端发送 current_mode_update。
+// 会话过期后可以调用 Forget，它的签名与 SessionExpireFunc 相同。
+type ModeRegistry struct {
+	modes  []SessionMode
+	models []ModelInfo
+
+	// changeMu 让模式的修改与对应 current_mode_update 的发送整体串行，
+	// 保证客户端按修改顺序收到更新。
+	changeMu sync.Mutex
+
+	mu sync.Mutex
+	// sessions 只保存与默认值不同的选择。
+	sessions map[SessionID]modeSelection
+}
+
+type modeSelection struct {
+	mode  SessionModeID
+	model ModelID
+}
+
+// NewModeRegistry 创建注册表，modes 与 models 中的第一项为新会话的默认选择，二者都可以为空。
+func NewModeRegistry(modes []SessionMode, models []ModelInfo) *ModeRegistry {
+	return &ModeRegistry{
+		modes:    append([]SessionMode(nil), modes...),
+		models:   append([]ModelInfo(nil), models...),
+		sessions: make(map[SessionID]modeSelection),
+	}
+}
+
+// defaults 返回新会话的默认选择。
+func (r *ModeRegistry) defaults() modeSelection {
+	var sel modeSelection
+	if len(r.modes) > 0 {
+		sel.mode = r.modes[0].ID
+	}
+	if len(r.models) > 0 {
+		sel.model = r.models[0].ModelID
+	}
+	return sel
+}
+
+// selection 返回会话的当前选择，未记录的会话使用默认值，调用方需持有 mu。
+func (r *ModeRegistry) selection(id SessionID) modeSelection {
+	if sel, ok := r.sessions[id]; ok {
+		return sel
+	}
+	return r.defaults()
+}
+
+// store 记录会话的选择，与默认值相同时删除记录，调用方需持有 mu。
+func (r *ModeRegistry) store(id SessionID, sel modeSelection) {
+	if sel == r.defaults() {
+		delete(r.sessions, id)
+		return
+	}
+	r.sessions[id] = sel
+}
+
+// State 返回会话的模式与模型状态，可直接用于 NewSessionResponse 与 LoadSessionResponse；
+// 未声明模式或模型时对应的返回值为 nil。
+func (r *ModeRegistry) State(id SessionID) (*SessionModeState, *SessionModelState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sel := r.selection(id)
+	var modes *SessionModeState
+	var models *SessionModelState
+	if len(r.modes) > 0 {
+		modes = &SessionModeState{CurrentModeID: sel.mode, AvailableModes: append([]SessionMode(nil), r.modes...)}
+	}
+	if len(r.models) > 0 {
+		models = &SessionModelState{CurrentModelID: sel.model, AvailableModels: append([]ModelInfo(nil), r.models...)}
+	}
+	return modes, models
+}
+
+// CurrentMode 返回会话的当前模式。
+func (r *ModeRegistry) CurrentMode(id SessionID) SessionModeID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.selection(id).mode
+}
+
+// CurrentModel 返回会话的当前模型。
+func (r *ModeRegistry) CurrentModel(id SessionID) ModelID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.selection(id).model
+}
+
+// SetSessionMode 处理 session/set_mode，未声明的模式返回 InvalidParams。
+func (r *ModeRegistry) SetSessionMode(_ context.Context, req SetSessionModeRequest) (SetSessionModeResponse, error) {
+	r.changeMu.Lock()
+	defer r.changeMu.Unlock()
+	_, err := r.setMode(req.SessionID, req.ModeID)
+	return SetSessionModeResponse{}, err
+}
+
+// SetSessionModel 处理 session/set_model，未声明的模型返回 InvalidParams。
+func (r *ModeRegistry) SetSessionModel(_ context.Context, req SetSessionModelRequest) (SetSessionModelResponse, error) {
+	if !r.hasModel(req.ModelID) {
+		return SetSessionModelResponse{}, InvalidParams().WithData(fmt.Sprintf("unknown model %q", req.ModelID))
+	}
+	r.mu.Lock()
+	sel := r.selection(req.SessionID)
+	sel.model = req.ModelID
+	r.store(req.SessionID, sel)
+	r.mu.Unlock()
+	return SetSessionModelResponse{}, nil
+}
+
+// ChangeMode 由代理主动切换 sender 所属会话的模式，模式确实改变时发送 current_mode_update。
+// 并发的切换按修改顺序发送。
+func (r *ModeRegistry) ChangeMode(sender *SessionSender, mode SessionModeID) error {
+	r.changeMu.Lock()
+	defer r.changeMu.Unlock()
+	changed, err := r.setMode(sender.SessionID(), mode)
+	if err != nil || !changed {
+		return err
+	}
+	return sender.CurrentMode(mode)
+}
+
+// Forget 丢弃会话的选择，之后再次出现时恢复默认值。
+// 只有选择过非默认模式或模型的会话才占用记录。
+func (r *ModeRegistry) Forget(id SessionID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, id)
+}
+
+// setMode 校验并记录模式，返回模式是否改变。
+func (r *ModeRegistry) setMode(id SessionID, mode SessionModeID) (bool, error) {
+	if !r.hasMode(mode) {
+		return false, InvalidParams().WithData(fmt.Sprintf("unknown mode %q", mode))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sel := r.selection(id)
+	changed := sel.mode != mode
+	sel.mode = mode
+	r.store(id, sel)
+	return changed, nil
+}
+
+func (r *ModeRegistry) hasMode(id SessionModeID) bool {
+	for _, mode := range r.modes {
+		if mode.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ModeRegistry) hasModel(id ModelID) bool {
+	for _, model := range r.models {
+		if model.ModelID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func newTestModeRegistry() *ModeRegistry {
+	return NewModeRegistry(
+		[]SessionMode{{ID: "ask", Name: "Ask"}, {ID: "code", Name: "Code"}},
+		[]ModelInfo{{ModelID: "small", Name: "Small"}, {ModelID: "large", Name: "Large"}},
+	)
+}
+
+func TestModeRegistryValidatesSetRequests(t *testing.T) {
+	reg := newTestModeRegistry()
+	ctx := context.Background()
+
+	modes, models := reg.State("s")
+	if modes == nil || modes.CurrentModeID != "ask" || len(modes.AvailableModes) != 2 {
+		t.Fatalf("unexpected default modes %+v", modes)
+	}
+	if models == nil || models.CurrentModelID != "small" || len(models.AvailableModels) != 2 {
+		t.Fatalf("unexpected default models %+v", models)
+	}
+
+	if _, err := reg.SetSessionMode(ctx, SetSessionModeRequest{SessionID: "s", ModeID: "code"}); err != nil {
+		t.Fatalf("set mode failed: %v", err)
+	}
+	if _, err := reg.SetSessionModel(ctx, SetSessionModelRequest{SessionID: "s", ModelID: "large"}); err != nil {
+		t.Fatalf("set model failed: %v", err)
+	}
+	if reg.CurrentMode("s") != "code" || reg.CurrentModel("s") != "large" {
+		t.Fatalf("unexpected selection %q/%q", reg.CurrentMode("s"), reg.CurrentModel("s"))
+	}
+
+	_, err := reg.SetSessionMode(ctx, SetSessionModeRequest{SessionID: "s", ModeID: "nope"})
+	if !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("expected invalid params for unknown mode, got %v", err)
+	}
+	_, err = reg.SetSessionModel(ctx, SetSessionModelRequest{SessionID: "s", ModelID: "nope"})
+	if !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("expected invalid params for unknown model, got %v", err)
+	}
+	if reg.CurrentMode("s") != "code" {
+		t.Fatalf("rejected request changed mode to %q", reg.CurrentMode("s"))
+	}
+
+	reg.Forget("s")
+	if reg.CurrentMode("s") != "ask" {
+		t.Fatalf("forgotten session should fall back to default mode, got %q", reg.CurrentMode("s"))
+	}
+
+	empty := NewModeRegistry(nil, nil)
+	if modes, models := empty.State("s"); modes != nil || models != nil {
+		t.Fatalf("expected nil state without declarations, got %+v %+v", modes, models)
+	}
+}
+
+func TestModeRegistryChangeModeEmitsUpdate(t *testing.T) {
+	reg := newTestModeRegistry()
+	agent := &mockAgent{setModeFunc: reg.SetSessionMode}
+	agent.promptFunc = func(ctx context.Context, req PromptRequest) (PromptResponse, error) {
+		client, _ := ClientFromContext(ctx)
+		s := client.SessionSender(ctx, req.SessionID)
+		for _, mode := range []SessionModeID{"code", "code", "ask"} {
+			if err := reg.ChangeMode(s, mode); err != nil {
+				return PromptResponse{}, err
+			}
+		}
+		return PromptResponse{StopReason: StopReasonEndTurn}, reg.ChangeMode(s, "nope")
+	}
+	client := &mockClient{sessionUpdateCh: make(chan SessionNotification, 8)}
+	_, clientConn := connectPair(t, agent, client, nil)
+	ctx := context.Background()
+
+	if _, err := clientConn.SetSessionMode(ctx, SetSessionModeRequest{SessionID: "s", ModeID: "nope"}); !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("expected invalid params over the wire, got %v", err)
+	}
+	_, err := clientConn.Prompt(ctx, PromptRequest{SessionID: "s", Prompt: []ContentBlock{NewTextContentBlock("hi")}})
+	if !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("expected invalid params for unknown mode change, got %v", err)
+	}
+	close(client.sessionUpdateCh)
+
+	var got []SessionModeID
+	for note := range client.sessionUpdateCh {
+		if note.Update.Type != SessionUpdateTypeCurrentMode {
+			t.Fatalf("unexpected update %+v", note.Update)
+		}
+		got = append(got, note.Update.CurrentModeID)
+	}
+	if len(got) != 2 || got[0] != "code" || got[1] != "ask" {
+		t.Fatalf("unexpected mode updates %v", got)
+	}
+}
+
+func TestModeRegistryReadsDoNotStore(t *testing.T) {
+	reg := newTestModeRegistry()
+	reg.State("a")
+	reg.CurrentMode("b")
+	reg.CurrentModel("c")
+	if _, err := reg.SetSessionModel(context.Background(), SetSessionModelRequest{SessionID: "d", ModelID: "small"}); err != nil {
+		t.Fatalf("set model failed: %v", err)
+	}
+	if len(reg.sessions) != 0 {
+		t.Fatalf("expected no stored selections, got %v", reg.sessions)
+	}
+}
+
+func TestModeRegistryConcurrentChangesArriveInOrder(t *testing.T) {
+	reg := newTestModeRegistry()
+	agent := &mockAgent{}
+	agent.promptFunc = func(ctx context.Context, req PromptRequest) (PromptResponse, error) {
+		client, _ := ClientFromContext(ctx)
+		s := client.SessionSender(ctx, req.SessionID)
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			mode := SessionModeID("code")
+			if i%2 == 1 {
+				mode = "ask"
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = reg.ChangeMode(s, mode)
+			}()
+		}
+		wg.Wait()
+		return PromptResponse{StopReason: StopReasonEndTurn}, nil
+	}
+	client := &mockClient{sessionUpdateCh: make(chan SessionNotification, 32)}
+	_, clientConn := connectPair(t, agent, client, nil)
+
+	if _, err := clientConn.Prompt(context.Background(), PromptRequest{SessionID: "s", Prompt: []ContentBlock{NewTextContentBlock("hi")}}); err != nil {
+		t.Fatalf("prompt failed: %v", err)
+	}
+	close(client.sessionUpdateCh)
+	var last SessionModeID
+	for note := range client.sessionUpdateCh {
+		last = note.Update.CurrentModeID
+	}
+	if last != reg.CurrentMode("s") {
+		t.Fatalf("last update %q does not match current mode %q", last, reg.CurrentMode("s"))
+	}
+}
@@ -0,0 +1,73 @@
+package acp
+
+import (
+	"log/slog"
+	"time"
+)
+
+// ConnectionOption 配置 AgentSideConnection 与 ClientSideConnection 的行为。
+type ConnectionOption func(*connectionOptions)
+
+type connectionOptions struct {
+	protocolVersions []ProtocolVersion
+	unstable         bool
+	errorMapper      ErrorMapper
+	router           *Router
+	inbound          []UnaryInterceptor
+	outbound         []UnaryInterceptor
+	requireAuth      bool
+	enforceLifecycle bool
+	stateHandlers    []StateChangeFunc
+	strict           bool
+	idGenerator      RequestIDGenerator
+	logger           *slog.Logger
+	turnPolicy       TurnPolicy
+	idleTimeout      time.Duration
+	expireHandlers   []SessionExpireFunc
+	idleAfterFunc    func(time.Duration, func()) idleTimer
+	commands         *Commands
+}
+
+func newConnectionOptions(opts []ConnectionOption) connectionOptions {
+	var o connectionOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// WithProtocolVersions 指定本端支持的协议版本，默认为 SupportedProtocolVersions()。
+func WithProtocolVersions(versions ...ProtocolVersion) ConnectionOption {
+	return func(o *connectionOptions) {
+		o.protocolVersions = append([]ProtocolVersion(nil), versions...)
+	}
+}
+
+func (o connectionOptions) supportedVersions() []ProtocolVersion {
+	if len(o.protocolVersions) == 0 {
+		return supportedProtocolVersions
+	}
+	return o.protocolVersions
+}
+
+// WithErrorMapper 指定处理器返回的非 acp.Error 错误如何转换为协议错误。
+func WithErrorMapper(mapper ErrorMapper) ConnectionOption {
+	return func(o *connectionOptions) {
+		o.errorMapper = mapper
+	}
+}
+
+// toError 将处理器返回的错误转换为响应中的协议错误。
+func (o connectionOptions) toError(err error) Error {
+	if acpErr, ok := asError(err); ok {
+		return acpErr
+	}
+	if o.errorMapper != nil {
+		if mapped, ok := o.errorMapper(err); ok {
+			return mapped
+		}
+	}
+	return IntoInternalError(err)
+}
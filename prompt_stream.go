@@ -0,0 +1,144 @@
+package acp
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// PromptStream 是一次 session/prompt 轮次的更新流。
+//
+// 在响应到达之前收到的该会话的 session/update 都会按顺序通过 Next 交付，
+// 之后 Next 返回 io.EOF，Result 返回最终响应。更新同时仍会交给 Client.SessionNotification。
+type PromptStream struct {
+	sessionID SessionID
+	conn      *ClientSideConnection
+
+	mu     sync.Mutex
+	queue  []SessionUpdate
+	signal chan struct{}
+
+	done chan struct{}
+	resp PromptResponse
+	err  error
+}
+
+// PromptStream 发送 session/prompt 并返回该轮次的更新流，请求错误通过 Result 返回。
+func (c *ClientSideConnection) PromptStream(ctx context.Context, req PromptRequest) *PromptStream {
+	s := &PromptStream{
+		sessionID: req.SessionID,
+		conn:      c,
+		signal:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	c.handler.streams.add(s)
+	go func() {
+		resp, err := c.Prompt(ctx, req)
+		// 先停止接收更新再结束，保证 EOF 之前的更新都已入队。
+		c.handler.streams.remove(s)
+		s.resp, s.err = resp, err
+		close(s.done)
+	}()
+	return s
+}
+
+// SessionID 返回流所属的会话。
+func (s *PromptStream) SessionID() SessionID {
+	return s.sessionID
+}
+
+// Next 返回下一条更新；轮次结束且所有更新都已交付后返回 io.EOF。
+func (s *PromptStream) Next(ctx context.Context) (SessionUpdate, error) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			update := s.queue[0]
+			s.queue[0] = SessionUpdate{}
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			return update, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.done:
+			s.mu.Lock()
+			empty := len(s.queue) == 0
+			s.mu.Unlock()
+			if empty {
+				return SessionUpdate{}, io.EOF
+			}
+		case <-s.signal:
+		case <-ctx.Done():
+			return SessionUpdate{}, ctx.Err()
+		}
+	}
+}
+
+// Result 等待轮次结束并返回响应。
+func (s *PromptStream) Result() (PromptResponse, error) {
+	<-s.done
+	return s.resp, s.err
+}
+
+// Done 返回在轮次结束时关闭的通道。
+func (s *PromptStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Cancel 为该会话发送 session/cancel。
+func (s *PromptStream) Cancel(ctx context.Context) error {
+	return s.conn.Cancel(ctx, CancelNotification{SessionID: s.sessionID})
+}
+
+// push 将更新入队，不会阻塞读循环。
+func (s *PromptStream) push(update SessionUpdate) {
+	s.mu.Lock()
+	s.queue = append(s.queue, update)
+	s.mu.Unlock()
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+// promptStreams 记录进行中的 PromptStream，按会话分发更新。
+type promptStreams struct {
+	mu      sync.Mutex
+	streams map[SessionID]map[*PromptStream]struct{}
+}
+
+func (p *promptStreams) add(s *PromptStream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.streams == nil {
+		p.streams = make(map[SessionID]map[*PromptStream]struct{})
+	}
+	if p.streams[s.sessionID] == nil {
+		p.streams[s.sessionID] = make(map[*PromptStream]struct{})
+	}
+	p.streams[s.sessionID][s] = struct{}{}
+}
+
+func (p *promptStreams) remove(s *PromptStream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.streams[s.sessionID], s)
+	if len(p.streams[s.sessionID]) == 0 {
+		delete(p.streams, s.sessionID)
+	}
+}
+
+func (p *promptStreams) deliver(note SessionNotification) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for s := range p.streams[note.SessionID] {
+		s.push(note.Update)
+	}
+}
+
+// sessionNotification 先将更新交给进行中的 PromptStream，再交给 session/update 的处理器。
+func (h *clientInboundHandler) sessionNotification(ctx context.Context, note SessionNotification, next func(context.Context) error) error {
+	h.streams.deliver(note)
+	return next(ctx)
+}
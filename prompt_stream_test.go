@@ -0,0 +1,95 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestPromptStreamDeliversTurnUpdates(t *testing.T) {
+	agent := &mockAgent{}
+	agent.promptFunc = func(ctx context.Context, req PromptRequest) (PromptResponse, error) {
+		client, _ := ClientFromContext(ctx)
+		s := client.SessionSender(ctx, req.SessionID)
+		other := client.SessionSender(ctx, "other")
+		for i := 0; i < 50; i++ {
+			if err := s.AgentText(fmt.Sprint(i)); err != nil {
+				return PromptResponse{}, err
+			}
+			if err := other.AgentText("noise"); err != nil {
+				return PromptResponse{}, err
+			}
+		}
+		return PromptResponse{StopReason: StopReasonEndTurn}, nil
+	}
+	client := &mockClient{sessionUpdateCh: make(chan SessionNotification, 1)}
+	_, clientConn := connectPair(t, agent, client, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream := clientConn.PromptStream(ctx, PromptRequest{SessionID: "s", Prompt: []ContentBlock{NewTextContentBlock("hi")}})
+
+	// 先等轮次结束，验证结束前到达的更新仍然全部可读。
+	<-stream.Done()
+	for i := 0; ; i++ {
+		update, err := stream.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			if i != 50 {
+				t.Fatalf("expected 50 updates, got %d", i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("next failed: %v", err)
+		}
+		if update.Content == nil || update.Content.Text != fmt.Sprint(i) {
+			t.Fatalf("update %d out of order: %+v", i, update.Content)
+		}
+	}
+	resp, err := stream.Result()
+	if err != nil || resp.StopReason != StopReasonEndTurn {
+		t.Fatalf("unexpected result %+v (%v)", resp, err)
+	}
+}
+
+func TestPromptStreamReportsErrors(t *testing.T) {
+	agent := &mockAgent{}
+	agent.promptFunc = func(ctx context.Context, req PromptRequest) (PromptResponse, error) {
+		return PromptResponse{}, InvalidParams()
+	}
+	_, clientConn := connectPair(t, agent, &mockClient{}, nil)
+
+	ctx := context.Background()
+	stream := clientConn.PromptStream(ctx, PromptRequest{SessionID: "s", Prompt: []ContentBlock{NewTextContentBlock("hi")}})
+	if _, err := stream.Next(ctx); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+	if _, err := stream.Result(); !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("expected invalid params, got %v", err)
+	}
+}
+
+func TestPromptStreamCancel(t *testing.T) {
+	started := make(chan struct{})
+	agent := &mockAgent{cancelCh: make(chan CancelNotification, 1)}
+	agent.promptFunc = func(ctx context.Context, req PromptRequest) (PromptResponse, error) {
+		close(started)
+		<-ctx.Done()
+		return PromptResponse{}, ctx.Err()
+	}
+	_, clientConn := connectPair(t, agent, &mockClient{}, nil)
+
+	ctx := context.Background()
+	stream := clientConn.PromptStream(ctx, PromptRequest{SessionID: "s", Prompt: []ContentBlock{NewTextContentBlock("hi")}})
+	<-started
+	if err := stream.Cancel(ctx); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+	resp, err := stream.Result()
+	if err != nil || resp.StopReason != StopReasonCancelled {
+		t.Fatalf("unexpected result %+v (%v)", resp, err)
+	}
+}
@@ -0,0 +1,61 @@
+package acp
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+)
+
+// RequestIDGenerator 生成出站请求的 ID，需要可以并发调用，且在连接内不重复。
+type RequestIDGenerator func() RequestID
+
+// NumericRequestIDs 返回从 1 开始递增的数字 ID 生成器，这是默认的生成方式。
+func NumericRequestIDs() RequestIDGenerator {
+	var next atomic.Int64
+	return func() RequestID {
+		return NewRequestIDNumber(next.Add(1))
+	}
+}
+
+// UUIDRequestIDs 返回生成随机 UUID（v4）字符串 ID 的生成器。
+func UUIDRequestIDs() RequestIDGenerator {
+	return func() RequestID {
+		var b [16]byte
+		if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+			panic(fmt.Sprintf("acp: generate request id: %v", err))
+		}
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		return NewRequestIDString(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]))
+	}
+}
+
+// WithRequestIDGenerator 指定出站请求 ID 的生成方式，默认为 NumericRequestIDs。
+func WithRequestIDGenerator(gen RequestIDGenerator) ConnectionOption {
+	return func(o *connectionOptions) {
+		o.idGenerator = gen
+	}
+}
+
+// WithLogger 指定记录协议异常（如孤立响应、重复的请求 ID）的日志器，默认不输出。
+func WithLogger(logger *slog.Logger) ConnectionOption {
+	return func(o *connectionOptions) {
+		o.logger = logger
+	}
+}
+
+func (o connectionOptions) requestIDGenerator() RequestIDGenerator {
+	if o.idGenerator == nil {
+		return NumericRequestIDs()
+	}
+	return o.idGenerator
+}
+
+func (o connectionOptions) log() *slog.Logger {
+	if o.logger == nil {
+		return slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return o.logger
+}
@@ -0,0 +1,244 @@
+package acp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// rawPeer 在线路上直接收发 JSON-RPC 消息，用于模拟行为不规范的对端。
+type rawPeer struct {
+	t       *testing.T
+	scanner *bufio.Scanner
+	w       io.Writer
+}
+
+func (p *rawPeer) read() jsonrpcEnvelope {
+	p.t.Helper()
+	if !p.scanner.Scan() {
+		p.t.Fatalf("peer read failed: %v", p.scanner.Err())
+	}
+	var envelope jsonrpcEnvelope
+	if err := json.Unmarshal(p.scanner.Bytes(), &envelope); err != nil {
+		p.t.Fatalf("peer decode failed: %v", err)
+	}
+	return envelope
+}
+
+func (p *rawPeer) write(line string) {
+	p.t.Helper()
+	if _, err := io.WriteString(p.w, line+"\n"); err != nil {
+		p.t.Fatalf("peer write failed: %v", err)
+	}
+}
+
+// newRawPeer 通过内存管道把 connect 创建的连接接到 rawPeer，测试结束时关闭两端。
+func newRawPeer(t *testing.T, connect func(ctx context.Context, w io.Writer, r io.Reader) (closeConn func())) *rawPeer {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	toPeerReader, toPeerWriter := io.Pipe()
+	fromPeerReader, fromPeerWriter := io.Pipe()
+	closeConn := connect(ctx, toPeerWriter, fromPeerReader)
+	t.Cleanup(func() {
+		cancel()
+		closeConn()
+		toPeerReader.Close()
+		fromPeerWriter.Close()
+	})
+	return &rawPeer{t: t, scanner: bufio.NewScanner(toPeerReader), w: fromPeerWriter}
+}
+
+func newRawPeerClient(t *testing.T, client Client, opts ...ConnectionOption) (*ClientSideConnection, *rawPeer) {
+	t.Helper()
+	var conn *ClientSideConnection
+	peer := newRawPeer(t, func(ctx context.Context, w io.Writer, r io.Reader) func() {
+		conn = NewClientSideConnection(ctx, client, w, r, opts...)
+		return conn.Close
+	})
+	return conn, peer
+}
+
+func newRawPeerAgent(t *testing.T, agent Agent, opts ...ConnectionOption) (*AgentSideConnection, *rawPeer) {
+	t.Helper()
+	var conn *AgentSideConnection
+	peer := newRawPeer(t, func(ctx context.Context, w io.Writer, r io.Reader) func() {
+		conn = NewAgentSideConnection(ctx, agent, w, r, opts...)
+		return conn.Close
+	})
+	return conn, peer
+}
+
+func TestRequestIDCanonicalKey(t *testing.T) {
+	cases := map[string]string{
+		`1`:      "1",
+		`"1"`:    "1",
+		` 1.0 `:  "1",
+		`"abc"`:  "abc",
+		`1e2`:    "100",
+		`"0042"`: "42",
+	}
+	for input, want := range cases {
+		var id RequestID
+		if err := json.Unmarshal([]byte(input), &id); err != nil {
+			t.Fatalf("unmarshal %s: %v", input, err)
+		}
+		if got := id.key(); got != want {
+			t.Fatalf("key(%s) = %q, want %q", input, got, want)
+		}
+	}
+
+	var id RequestID
+	if err := json.Unmarshal([]byte(`{"a":1}`), &id); err == nil {
+		t.Fatalf("expected error for object id")
+	}
+}
+
+func TestRequestIDGenerators(t *testing.T) {
+	numeric := NumericRequestIDs()
+	if n, _ := numeric().AsNumber(); n != 1 {
+		t.Fatalf("expected first id 1, got %d", n)
+	}
+	if n, _ := numeric().AsNumber(); n != 2 {
+		t.Fatalf("expected second id 2, got %d", n)
+	}
+
+	uuid := UUIDRequestIDs()
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	first, _ := uuid().AsString()
+	second, _ := uuid().AsString()
+	if !pattern.MatchString(first) || first == second {
+		t.Fatalf("unexpected uuid ids %q %q", first, second)
+	}
+}
+
+func TestResponseWithStringifiedIDIsCorrelated(t *testing.T) {
+	conn, peer := newRawPeerClient(t, &mockClient{})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Authenticate(context.Background(), AuthenticateRequest{MethodID: "token"})
+		done <- err
+	}()
+
+	req := peer.read()
+	if req.ID == nil || req.ID.String() != "1" {
+		t.Fatalf("unexpected request id %v", req.ID)
+	}
+	peer.write(`{"jsonrpc":"2.0","id":"1","result":{}}`)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("authenticate failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("response with string id was not correlated")
+	}
+}
+
+func TestCustomRequestIDGenerator(t *testing.T) {
+	conn, peer := newRawPeerClient(t, &mockClient{}, WithRequestIDGenerator(UUIDRequestIDs()))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Authenticate(context.Background(), AuthenticateRequest{MethodID: "token"})
+		done <- err
+	}()
+
+	req := peer.read()
+	id, ok := req.ID.AsString()
+	if !ok || len(id) != 36 {
+		t.Fatalf("expected uuid id, got %v", req.ID)
+	}
+	peer.write(`{"jsonrpc":"2.0","id":"` + id + `","result":{}}`)
+	if err := <-done; err != nil {
+		t.Fatalf("authenticate failed: %v", err)
+	}
+}
+
+func TestDuplicateInboundRequestID(t *testing.T) {
+	release := make(chan struct{})
+	client := &mockClient{
+		requestPermissionFunc: func(ctx context.Context, req RequestPermissionRequest) (RequestPermissionResponse, error) {
+			<-release
+			return RequestPermissionResponse{Outcome: RequestPermissionOutcome{Outcome: "cancelled"}}, nil
+		},
+	}
+	logs := &syncBuffer{}
+	_, peer := newRawPeerClient(t, client, WithLogger(slog.New(slog.NewTextHandler(logs, nil))))
+
+	params := `{"sessionId":"s","toolCall":{"toolCallId":"t"},"options":[]}`
+	peer.write(`{"jsonrpc":"2.0","id":7,"method":"session/request_permission","params":` + params + `}`)
+	peer.write(`{"jsonrpc":"2.0","id":"7","method":"session/request_permission","params":` + params + `}`)
+
+	resp := peer.read()
+	if resp.Error == nil || resp.Error.Code != ErrorCodeInvalidRequest.Code {
+		t.Fatalf("expected invalid request error for duplicate id, got %+v", resp)
+	}
+	if resp.ID != nil && !resp.ID.IsNull() {
+		t.Fatalf("duplicate must not be answered under the id in use, got %v", resp.ID)
+	}
+
+	close(release)
+	resp = peer.read()
+	if resp.Error != nil || resp.Result == nil {
+		t.Fatalf("expected result for original request, got %+v", resp)
+	}
+	if !strings.Contains(logs.String(), "duplicate inbound request id") {
+		t.Fatalf("expected duplicate id warning, got %q", logs.String())
+	}
+}
+
+func TestOrphanResponseIsLogged(t *testing.T) {
+	logs := &syncBuffer{}
+	_, peer := newRawPeerClient(t, &mockClient{}, WithLogger(slog.New(slog.NewTextHandler(logs, nil))))
+
+	peer.write(`{"jsonrpc":"2.0","id":99,"result":{}}`)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(logs.String(), "response for unknown request id") {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected orphan response warning, got %q", logs.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestResponseEchoesRawRequestID(t *testing.T) {
+	_, peer := newRawPeerClient(t, &mockClient{})
+
+	peer.write(`{"jsonrpc":"2.0","id":1.0,"method":"fs/read_text_file","params":{"sessionId":"s","path":"/tmp/a"}}`)
+	resp := peer.read()
+	raw, err := json.Marshal(resp.ID)
+	if err != nil {
+		t.Fatalf("marshal id: %v", err)
+	}
+	if string(raw) != "1.0" {
+		t.Fatalf("response id %s differs from request id 1.0", raw)
+	}
+}
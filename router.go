@@ -0,0 +1,301 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// RequestHandlerFunc 处理一个请求，返回值将被编码为响应的 result。
+type RequestHandlerFunc func(ctx context.Context, params json.RawMessage) (any, error)
+
+// NotificationHandlerFunc 处理一个通知。
+type NotificationHandlerFunc func(ctx context.Context, params json.RawMessage) error
+
+// Router 按方法名注册请求与通知处理器。
+//
+// 连接在分发时先查找通过 WithRouter 提供的 Router，再回退到由 Agent/Client
+// 接口生成的默认注册，因此可以用它添加新方法或覆盖内置方法。
+// 覆盖内置方法时，SDK 的簿记逻辑（初始化时记录能力与协商版本、prompt 轮次与取消、
+// 斜杠命令、会话空闲计时、终端跟踪等）仍在所选处理器外执行。
+// Router 可以安全地被并发使用，也可以在多个连接之间共享。
+type Router struct {
+	mu            sync.RWMutex
+	requests      map[string]requestRoute
+	notifications map[string]requestRoute
+	// hooks 只在默认注册中使用，包在用户或默认处理器外。
+	hooks map[string]routeHook
+}
+
+// requestRoute 将参数解码与处理分开，以便拦截器看到解码后的参数。
+type requestRoute struct {
+	decode func(params json.RawMessage, strict bool) (any, error)
+	call   Invoker
+}
+
+// NewRouter 创建空的 Router。
+func NewRouter() *Router {
+	return &Router{
+		requests:      make(map[string]requestRoute),
+		notifications: make(map[string]requestRoute),
+	}
+}
+
+// Register 注册请求处理器，已存在的注册会被替换。
+func (r *Router) Register(method string, fn RequestHandlerFunc) {
+	r.register(r.requests, method, requestRoute{
+		decode: rawParams,
+		call: func(ctx context.Context, params any) (any, error) {
+			raw, _ := params.(json.RawMessage)
+			return fn(ctx, raw)
+		},
+	})
+}
+
+// RegisterNotification 注册通知处理器，已存在的注册会被替换。
+func (r *Router) RegisterNotification(method string, fn NotificationHandlerFunc) {
+	r.register(r.notifications, method, requestRoute{
+		decode: rawParams,
+		call: func(ctx context.Context, params any) (any, error) {
+			raw, _ := params.(json.RawMessage)
+			return nil, fn(ctx, raw)
+		},
+	})
+}
+
+func (r *Router) register(routes map[string]requestRoute, method string, route requestRoute) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	routes[method] = route
+}
+
+// Remove 移除方法的请求与通知处理器。
+func (r *Router) Remove(method string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.requests, method)
+	delete(r.notifications, method)
+}
+
+// lookup 查找处理器，r 为 nil 时返回 false。
+func (r *Router) lookup(notification bool, method string) (requestRoute, bool) {
+	if r == nil {
+		return requestRoute{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	routes := r.requests
+	if notification {
+		routes = r.notifications
+	}
+	route, ok := routes[method]
+	return route, ok
+}
+
+// routeHook 包在所选处理器外执行 SDK 的簿记逻辑。
+// params 为路由解码后的参数，可能是请求类型，也可能是 json.RawMessage。
+type routeHook func(ctx context.Context, params any, next Invoker) (any, error)
+
+// hook 为方法安装 routeHook，已存在的会被替换。
+func (r *Router) hook(method string, h routeHook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.hooks == nil {
+		r.hooks = make(map[string]routeHook)
+	}
+	r.hooks[method] = h
+}
+
+// wrap 在 call 外包上方法的 routeHook，没有时原样返回。
+func (r *Router) wrap(method string, call Invoker) Invoker {
+	if r == nil {
+		return call
+	}
+	r.mu.RLock()
+	h, ok := r.hooks[method]
+	r.mu.RUnlock()
+	if !ok {
+		return call
+	}
+	return func(ctx context.Context, params any) (any, error) {
+		return h(ctx, params, call)
+	}
+}
+
+// hookRequest 将类型化的簿记逻辑包装为 routeHook。
+// 路由解码为 Req 时 next 收到 fn 传入的请求，否则收到原始参数；
+// 路由返回的结果不是 Resp 时经 JSON 转换。
+func hookRequest[Req, Resp any](fn func(ctx context.Context, req Req, next func(context.Context, Req) (Resp, error)) (Resp, error)) routeHook {
+	return func(ctx context.Context, params any, call Invoker) (any, error) {
+		req, err := hookParams[Req](params)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := fn(ctx, req, func(ctx context.Context, req Req) (Resp, error) {
+			var arg any = req
+			if _, typed := params.(Req); !typed {
+				arg = params
+			}
+			out, err := call(ctx, arg)
+			if err != nil {
+				var zero Resp
+				return zero, err
+			}
+			return hookResult[Resp](out)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// hookNotification 将类型化的簿记逻辑包装为通知的 routeHook。
+func hookNotification[Req any](fn func(ctx context.Context, req Req, next func(context.Context) error) error) routeHook {
+	return func(ctx context.Context, params any, call Invoker) (any, error) {
+		req, err := hookParams[Req](params)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fn(ctx, req, func(ctx context.Context) error {
+			_, err := call(ctx, params)
+			return err
+		})
+	}
+}
+
+// hookParams 取回路由解码后的参数，原始参数按 Req 解码。
+func hookParams[Req any](params any) (Req, error) {
+	if raw, ok := params.(json.RawMessage); ok {
+		req, err := decodeParams[Req](raw)
+		if err != nil {
+			return req, InvalidParams().WithData(err.Error())
+		}
+		return req, nil
+	}
+	return paramsAs[Req](params)
+}
+
+// hookResult 将处理器的结果转换为 Resp。
+func hookResult[Resp any](out any) (Resp, error) {
+	var resp Resp
+	switch v := out.(type) {
+	case Resp:
+		return v, nil
+	case nil:
+		return resp, nil
+	}
+	raw, err := json.Marshal(out)
+	if err == nil {
+		err = json.Unmarshal(raw, &resp)
+	}
+	if err != nil {
+		return resp, InternalError().WithData(fmt.Sprintf("unexpected result type %T: %v", out, err))
+	}
+	return resp, nil
+}
+
+func rawParams(params json.RawMessage, _ bool) (any, error) {
+	return params, nil
+}
+
+// typedParams 将参数解码为 Req，失败时返回 InvalidParams。
+func typedParams[Req any](params json.RawMessage, strict bool) (any, error) {
+	if strict {
+		return decodeStrict[Req](params)
+	}
+	req, err := decodeParams[Req](params)
+	if err != nil {
+		return nil, InvalidParams().WithData(err.Error())
+	}
+	return req, nil
+}
+
+// paramsAs 取回拦截器传递的参数，类型不符时返回内部错误。
+func paramsAs[Req any](params any) (Req, error) {
+	req, ok := params.(Req)
+	if !ok {
+		var zero Req
+		return zero, InternalError().WithData(fmt.Sprintf("unexpected params type %T", params))
+	}
+	return req, nil
+}
+
+// Handle 以类型化的方式注册请求处理器，参数解码失败时返回 InvalidParams。
+func Handle[Req, Resp any](r *Router, method string, fn func(context.Context, Req) (Resp, error)) {
+	r.register(r.requests, method, requestRoute{
+		decode: typedParams[Req],
+		call: func(ctx context.Context, params any) (any, error) {
+			req, err := paramsAs[Req](params)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := fn(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			return resp, nil
+		},
+	})
+}
+
+// HandleNotification 以类型化的方式注册通知处理器。
+func HandleNotification[Req any](r *Router, method string, fn func(context.Context, Req) error) {
+	r.register(r.notifications, method, requestRoute{
+		decode: typedParams[Req],
+		call: func(ctx context.Context, params any) (any, error) {
+			req, err := paramsAs[Req](params)
+			if err != nil {
+				return nil, err
+			}
+			return nil, fn(ctx, req)
+		},
+	})
+}
+
+// WithRouter 指定优先于默认注册的 Router。
+func WithRouter(r *Router) ConnectionOption {
+	return func(o *connectionOptions) {
+		o.router = r
+	}
+}
+
+// dispatchRequest 依次在用户 Router 与默认 Router 中查找请求处理器，并在默认注册的 routeHook 中调用。
+func dispatchRequest(ctx context.Context, opts connectionOptions, builtin *Router, method string, params json.RawMessage) (any, Error, bool) {
+	route, ok := opts.router.lookup(false, method)
+	if !ok {
+		route, ok = builtin.lookup(false, method)
+	}
+	if !ok {
+		return nil, Error{}, false
+	}
+	req, err := route.decode(params, opts.strict)
+	if err != nil {
+		return nil, opts.toError(err), true
+	}
+	resp, err := opts.interceptInbound(ctx, CallInfo{Method: method}, req, builtin.wrap(method, route.call))
+	if err != nil {
+		return nil, opts.toError(err), true
+	}
+	return resp, Error{}, true
+}
+
+// dispatchNotification 依次在用户 Router 与默认 Router 中查找通知处理器，并在默认注册的 routeHook 中调用。
+func dispatchNotification(ctx context.Context, opts connectionOptions, builtin *Router, method string, params json.RawMessage) (Error, bool) {
+	route, ok := opts.router.lookup(true, method)
+	if !ok {
+		route, ok = builtin.lookup(true, method)
+	}
+	if !ok {
+		return Error{}, false
+	}
+	req, err := route.decode(params, opts.strict)
+	if err != nil {
+		return opts.toError(err), true
+	}
+	if _, err := opts.interceptInbound(ctx, CallInfo{Method: method, Notification: true}, req, builtin.wrap(method, route.call)); err != nil {
+		return opts.toError(err), true
+	}
+	return Error{}, true
+}
@@ -0,0 +1,137 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+type echoRequest struct {
+	Text string `json:"text"`
+}
+
+type echoResponse struct {
+	Text string `json:"text"`
+}
+
+func TestRouterCustomMethod(t *testing.T) {
+	router := NewRouter()
+	Handle(router, "vendor/echo", func(_ context.Context, req echoRequest) (echoResponse, error) {
+		return echoResponse{Text: req.Text}, nil
+	})
+	handler := &agentInboundHandler{
+		agent: &testAgent{},
+		opts:  newConnectionOptions([]ConnectionOption{WithRouter(router)}),
+	}
+
+	resp, errObj, _ := handler.handleRequest(context.Background(), "vendor/echo", mustRawJSON(echoRequest{Text: "hi"}))
+	if errObj.Code != 0 {
+		t.Fatalf("unexpected error: %+v", errObj)
+	}
+	if got, ok := resp.(echoResponse); !ok || got.Text != "hi" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+
+	_, errObj, _ = handler.handleRequest(context.Background(), "vendor/echo", []byte(`[]`))
+	if errObj.Code != ErrorCodeInvalidParams.Code {
+		t.Fatalf("expected invalid params, got %+v", errObj)
+	}
+}
+
+func TestRouterOverridesBuiltin(t *testing.T) {
+	agent := &testAgent{}
+	router := NewRouter()
+	Handle(router, AgentMethods.SessionSetModel, func(context.Context, SetSessionModelRequest) (SetSessionModelResponse, error) {
+		return SetSessionModelResponse{}, ResourceNotFound(nil)
+	})
+	handler := &agentInboundHandler{
+		agent: agent,
+		opts:  newConnectionOptions([]ConnectionOption{WithRouter(router)}),
+	}
+
+	_, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.SessionSetModel, mustRawJSON(SetSessionModelRequest{
+		SessionID: "sess",
+		ModelID:   "m",
+	}))
+	if errObj.Code != ErrorCodeResourceNotFound.Code {
+		t.Fatalf("expected override to run, got %+v", errObj)
+	}
+	if agent.setModelCalled {
+		t.Fatalf("expected builtin handler to be bypassed")
+	}
+
+	router.Remove(AgentMethods.SessionSetModel)
+	_, errObj, _ = handler.handleRequest(context.Background(), AgentMethods.SessionSetModel, mustRawJSON(SetSessionModelRequest{
+		SessionID: "sess",
+		ModelID:   "m",
+	}))
+	if errObj.Code != 0 || !agent.setModelCalled {
+		t.Fatalf("expected builtin handler after removal, got %+v", errObj)
+	}
+}
+
+func TestRouterNotification(t *testing.T) {
+	router := NewRouter()
+	received := ""
+	HandleNotification(router, "vendor/ping", func(_ context.Context, req echoRequest) error {
+		received = req.Text
+		return nil
+	})
+	handler := &clientInboundHandler{
+		client: &testClient{},
+		opts:   newConnectionOptions([]ConnectionOption{WithRouter(router)}),
+	}
+	if errObj := handler.handleNotification(context.Background(), "vendor/ping", mustRawJSON(echoRequest{Text: "pong"})); errObj.Code != 0 {
+		t.Fatalf("unexpected error: %+v", errObj)
+	}
+	if received != "pong" {
+		t.Fatalf("unexpected payload %q", received)
+	}
+}
+
+func TestRouterOverrideKeepsInitializeBookkeeping(t *testing.T) {
+	ctx := context.Background()
+	router := NewRouter()
+	Handle(router, AgentMethods.Initialize, func(context.Context, InitializeRequest) (InitializeResponse, error) {
+		return InitializeResponse{}, nil
+	})
+	agentConn, clientConn := connectPair(t, &mockAgent{}, &mockClient{}, []ConnectionOption{WithRouter(router)})
+
+	resp, err := clientConn.Initialize(ctx, InitializeRequest{
+		ProtocolVersion:    ProtocolVersionV1,
+		ClientCapabilities: ClientCapabilities{FS: FileSystemCapability{ReadTextFile: true}},
+	})
+	if err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	if resp.ProtocolVersion != ProtocolVersionV1 {
+		t.Fatalf("expected negotiated version, got %v", resp.ProtocolVersion)
+	}
+	if caps, ok := agentConn.PeerCapabilities(); !ok || !caps.FS.ReadTextFile {
+		t.Fatalf("overridden initialize should still record peer capabilities, got %+v (ok=%v)", caps, ok)
+	}
+	if _, err := agentConn.ReadTextFile(ctx, ReadTextFileRequest{SessionID: "sess", Path: "/tmp/a"}); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+}
+
+func TestRouterRawPromptOverrideIsCancellable(t *testing.T) {
+	ctx := context.Background()
+	started := make(chan struct{})
+	router := NewRouter()
+	router.Register(AgentMethods.SessionPrompt, func(ctx context.Context, _ json.RawMessage) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return map[string]string{"stopReason": "end_turn"}, nil
+	})
+	_, clientConn := connectPair(t, &mockAgent{cancelCh: make(chan CancelNotification, 1)}, &mockClient{}, []ConnectionOption{WithRouter(router)})
+
+	res := promptAsync(clientConn, "s", "hi")
+	<-started
+	if err := clientConn.Cancel(ctx, CancelNotification{SessionID: "s"}); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+	if r := <-res; r.err != nil || r.resp.StopReason != StopReasonCancelled {
+		t.Fatalf("overridden prompt should still be cancelled, got %+v (%v)", r.resp, r.err)
+	}
+}
@@ -6,8 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"sync"
-	"sync/atomic"
 )
 
 type rpcConnection struct {
@@ -15,18 +15,38 @@ type rpcConnection struct {
 	encoder   *json.Encoder
 	reader    *bufio.Reader
 	handler   inboundHandler
-	nextID    atomic.Int64
+	opts      connectionOptions
+	peer      ExtCaller
+	nextID    RequestIDGenerator
+	logger    *slog.Logger
 	pendingMu sync.Mutex
 	pending   map[string]*pendingRequest
-	broadcast *streamBroadcast
-	closeOnce sync.Once
-	closeErr  error
-	closeCh   chan struct{}
+	// inflight 记录正在处理的入站请求 ID，用于识别重复的 ID。
+	inflightMu sync.Mutex
+	inflight   map[string]struct{}
+	broadcast  *streamBroadcast
+	closeOnce  sync.Once
+	closeErr   error
+	closeCh    chan struct{}
 }
 
 type inboundHandler interface {
 	handleRequest(context.Context, string, json.RawMessage) (any, Error, bool)
 	handleNotification(context.Context, string, json.RawMessage) Error
+	checkOutbound(method string) error
+	handleClose(error)
+}
+
+// responseHook 由需要在成功响应发出之后执行后续动作的 handler 实现，
+// 此时发送的消息保证排在响应之后。
+type responseHook interface {
+	afterResponse(ctx context.Context, method string, params json.RawMessage, res any)
+}
+
+// requestReserver 由需要在读循环中同步登记入站请求的 handler 实现，
+// 保证随后读到的消息能观察到这次登记；release 在请求处理结束后调用。
+type requestReserver interface {
+	reserveRequest(ctx context.Context, method string, params json.RawMessage) (context.Context, func())
 }
 
 type pendingRequest struct {
@@ -40,7 +60,7 @@ type rpcResult struct {
 
 type jsonrpcEnvelope struct {
 	JSONRPC string           `json:"jsonrpc"`
-	ID      *json.RawMessage `json:"id,omitempty"`
+	ID      *RequestID       `json:"id,omitempty"`
 	Method  string           `json:"method,omitempty"`
 	Params  *json.RawMessage `json:"params,omitempty"`
 	Result  *json.RawMessage `json:"result,omitempty"`
@@ -52,38 +72,58 @@ func newRPCConnection(
 	handler inboundHandler,
 	outgoingWriter io.Writer,
 	incomingReader io.Reader,
+	opts connectionOptions,
 ) *rpcConnection {
 	conn := &rpcConnection{
 		outgoing:  make(chan jsonrpcEnvelope, 32),
 		encoder:   json.NewEncoder(outgoingWriter),
 		reader:    bufio.NewReader(incomingReader),
 		handler:   handler,
+		opts:      opts,
+		nextID:    opts.requestIDGenerator(),
+		logger:    opts.log(),
 		pending:   make(map[string]*pendingRequest),
+		inflight:  make(map[string]struct{}),
 		broadcast: newStreamBroadcast(),
 		closeCh:   make(chan struct{}),
 	}
-
-	go conn.writeLoop()
-	go conn.readLoop(ctx)
-
 	return conn
 }
 
+// start 启动读写循环，应在连接的其他字段就绪后调用。
+func (c *rpcConnection) start(ctx context.Context) {
+	go c.writeLoop()
+	go c.readLoop(ctx)
+}
+
 func (c *rpcConnection) Close(err error) {
 	c.closeOnce.Do(func() {
 		c.closeErr = err
 		close(c.closeCh)
-		close(c.outgoing)
 		c.pendingMu.Lock()
 		for _, p := range c.pending {
 			p.result <- rpcResult{err: &Error{Code: ErrorCodeInternalError.Code, Message: err.Error()}}
 		}
 		c.pending = map[string]*pendingRequest{}
 		c.pendingMu.Unlock()
+		c.handler.handleClose(err)
 	})
 }
 
 func (c *rpcConnection) notify(ctx context.Context, method string, params any) error {
+	if err := c.handler.checkOutbound(method); err != nil {
+		return err
+	}
+	_, err := c.opts.interceptOutbound(ctx, CallInfo{Method: method, Notification: true}, params, func(ctx context.Context, params any) (any, error) {
+		return nil, c.sendNotification(ctx, method, params)
+	})
+	return err
+}
+
+func (c *rpcConnection) sendNotification(ctx context.Context, method string, params any) error {
+	if err := c.closedErr(); err != nil {
+		return err
+	}
 	raw, err := marshalRaw(params)
 	if err != nil {
 		return err
@@ -112,16 +152,39 @@ func (c *rpcConnection) notify(ctx context.Context, method string, params any) e
 }
 
 func (c *rpcConnection) request(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	if err := c.handler.checkOutbound(method); err != nil {
+		return nil, err
+	}
+	result, err := c.opts.interceptOutbound(ctx, CallInfo{Method: method}, params, func(ctx context.Context, params any) (any, error) {
+		return c.sendRequest(ctx, method, params)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 拦截器可以直接返回类型化的结果，统一编码后交给调用方解码。
+	raw, err := marshalRaw(result)
+	if err != nil {
+		return nil, fmt.Errorf("acp: encode %s result: %w", method, err)
+	}
+	return raw, nil
+}
+
+func (c *rpcConnection) sendRequest(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	if err := c.closedErr(); err != nil {
+		return nil, err
+	}
 	raw, err := marshalRaw(params)
 	if err != nil {
 		return nil, err
 	}
 
-	id := c.nextID.Add(1)
-	idRaw := json.RawMessage([]byte(fmt.Sprintf("%d", id)))
+	id := c.nextID()
+	if id.IsNull() {
+		return nil, fmt.Errorf("request id generator returned null id")
+	}
 	envelope := jsonrpcEnvelope{
 		JSONRPC: "2.0",
-		ID:      &idRaw,
+		ID:      &id,
 		Method:  method,
 	}
 	if raw != nil {
@@ -131,9 +194,13 @@ func (c *rpcConnection) request(ctx context.Context, method string, params any)
 	pending := &pendingRequest{
 		result: make(chan rpcResult, 1),
 	}
-	key := string(idRaw)
+	key := id.key()
 
 	c.pendingMu.Lock()
+	if _, exists := c.pending[key]; exists {
+		c.pendingMu.Unlock()
+		return nil, fmt.Errorf("request id %s is already in use", id)
+	}
 	c.pending[key] = pending
 	c.pendingMu.Unlock()
 
@@ -142,7 +209,7 @@ func (c *rpcConnection) request(ctx context.Context, method string, params any)
 		c.removePending(key)
 		return nil, ctx.Err()
 	case c.outgoing <- envelope:
-		c.broadcast.outgoingRequest(string(idRaw), method, raw)
+		c.broadcast.outgoingRequest(id.String(), method, raw)
 	case <-c.closeCh:
 		c.removePending(key)
 		if c.closeErr != nil {
@@ -176,20 +243,54 @@ func (c *rpcConnection) removePending(key string) {
 }
 
 func (c *rpcConnection) writeLoop() {
-	for envelope := range c.outgoing {
-		if err := c.encoder.Encode(envelope); err != nil {
-			c.Close(err)
+	for {
+		select {
+		case envelope := <-c.outgoing:
+			if err := c.encoder.Encode(envelope); err != nil {
+				c.Close(err)
+				return
+			}
+		case <-c.closeCh:
+			c.drainOutgoing()
+			return
+		}
+	}
+}
+
+// drainOutgoing 在连接关闭后写出已经入队的消息，例如处理器的最终响应。
+func (c *rpcConnection) drainOutgoing() {
+	for {
+		select {
+		case envelope := <-c.outgoing:
+			if err := c.encoder.Encode(envelope); err != nil {
+				return
+			}
+		default:
 			return
 		}
 	}
 }
 
+// closedErr 在连接已关闭时返回关闭原因，否则返回 nil。
+func (c *rpcConnection) closedErr() error {
+	select {
+	case <-c.closeCh:
+		if c.closeErr != nil {
+			return c.closeErr
+		}
+		return fmt.Errorf("connection closed")
+	default:
+		return nil
+	}
+}
+
 func (c *rpcConnection) readLoop(ctx context.Context) {
 	scanner := bufio.NewScanner(c.reader)
 	for scanner.Scan() {
 		line := scanner.Bytes()
 		var envelope jsonrpcEnvelope
 		if err := json.Unmarshal(line, &envelope); err != nil {
+			c.logger.Warn("acp: dropping malformed message", "error", err)
 			continue
 		}
 		c.handleIncoming(ctx, envelope)
@@ -210,17 +311,34 @@ func (c *rpcConnection) handleIncoming(ctx context.Context, envelope jsonrpcEnve
 		if envelope.Params != nil {
 			params = *envelope.Params
 		}
-		c.broadcast.incomingRequest(string(*envelope.ID), envelope.Method, params)
-		go c.dispatchRequest(ctx, envelope.Method, params, envelope.ID)
+		id := *envelope.ID
+		c.broadcast.incomingRequest(id.String(), envelope.Method, params)
+		if !c.beginInbound(id) {
+			c.logger.Warn("acp: duplicate inbound request id", "id", id.String(), "method", envelope.Method)
+			// 不能以正在使用的 ID 回应，否则对端会把它当作原请求的响应。
+			go c.sendResponse(ctx, RequestIDNull, nil, InvalidRequest().WithData(fmt.Sprintf("request id %s is already in use", id)))
+			return
+		}
+		reqCtx := c.inboundContext(ctx, envelope.Method, params, &id)
+		release := func() {}
+		if r, ok := c.handler.(requestReserver); ok {
+			reqCtx, release = r.reserveRequest(reqCtx, envelope.Method, params)
+		}
+		go func() {
+			defer release()
+			c.dispatchRequest(reqCtx, envelope.Method, params, id)
+		}()
 	case hasID:
-		key := string(*envelope.ID)
+		id := *envelope.ID
+		key := id.String()
 		c.pendingMu.Lock()
-		pending := c.pending[key]
+		pending := c.pending[id.key()]
 		if pending != nil {
-			delete(c.pending, key)
+			delete(c.pending, id.key())
 		}
 		c.pendingMu.Unlock()
 		if pending == nil {
+			c.logger.Warn("acp: response for unknown request id", "id", key)
 			return
 		}
 
@@ -243,7 +361,7 @@ func (c *rpcConnection) handleIncoming(ctx context.Context, envelope jsonrpcEnve
 			params = *envelope.Params
 		}
 		c.broadcast.incomingNotification(envelope.Method, params)
-		if err := c.handler.handleNotification(ctx, envelope.Method, params); err.Code != 0 && err.Message != "" {
+		if err := c.handler.handleNotification(c.inboundContext(ctx, envelope.Method, params, nil), envelope.Method, params); err.Code != 0 && err.Message != "" {
 			// notifications do not send response; log could be added
 		}
 	default:
@@ -251,28 +369,34 @@ func (c *rpcConnection) handleIncoming(ctx context.Context, envelope jsonrpcEnve
 	}
 }
 
-func (c *rpcConnection) dispatchRequest(ctx context.Context, method string, params json.RawMessage, id *json.RawMessage) {
+func (c *rpcConnection) dispatchRequest(ctx context.Context, method string, params json.RawMessage, id RequestID) {
+	defer c.endInbound(id)
 	res, err, ok := c.handler.handleRequest(ctx, method, params)
 	if !ok {
 		return
 	}
+	c.sendResponse(ctx, id, res, err)
+	if hook, ok := c.handler.(responseHook); ok && err.Code == 0 && err.Message == "" {
+		hook.afterResponse(ctx, method, params, res)
+	}
+}
+
+// sendResponse 编码并发送请求 id 的响应，err 非零时发送错误响应。
+func (c *rpcConnection) sendResponse(ctx context.Context, id RequestID, res any, err Error) {
 	envelope := jsonrpcEnvelope{
 		JSONRPC: "2.0",
-	}
-	if id != nil {
-		idCopy := append(json.RawMessage(nil), (*id)...)
-		envelope.ID = &idCopy
+		ID:      &id,
 	}
 	if err.Code != 0 || err.Message != "" {
 		errCopy := err
 		envelope.Error = &errCopy
-		c.broadcast.outgoingResponse(string(*envelope.ID), nil, &errCopy)
+		c.broadcast.outgoingResponse(id.String(), nil, &errCopy)
 	} else {
 		raw, marshalErr := marshalRaw(res)
 		if marshalErr != nil {
 			errCopy := IntoInternalError(marshalErr)
 			envelope.Error = &errCopy
-			c.broadcast.outgoingResponse(string(*envelope.ID), nil, &errCopy)
+			c.broadcast.outgoingResponse(id.String(), nil, &errCopy)
 		} else {
 			if raw != nil {
 				envelope.Result = &raw
@@ -280,7 +404,7 @@ func (c *rpcConnection) dispatchRequest(ctx context.Context, method string, para
 				nullRaw := json.RawMessage("null")
 				envelope.Result = &nullRaw
 			}
-			c.broadcast.outgoingResponse(string(*envelope.ID), envelope.Result, nil)
+			c.broadcast.outgoingResponse(id.String(), envelope.Result, nil)
 		}
 	}
 	select {
@@ -290,6 +414,23 @@ func (c *rpcConnection) dispatchRequest(ctx context.Context, method string, para
 	}
 }
 
+// beginInbound 登记入站请求 ID，ID 已在处理中时返回 false。
+func (c *rpcConnection) beginInbound(id RequestID) bool {
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+	if _, exists := c.inflight[id.key()]; exists {
+		return false
+	}
+	c.inflight[id.key()] = struct{}{}
+	return true
+}
+
+func (c *rpcConnection) endInbound(id RequestID) {
+	c.inflightMu.Lock()
+	delete(c.inflight, id.key())
+	c.inflightMu.Unlock()
+}
+
 func marshalRaw(value any) (json.RawMessage, error) {
 	if value == nil {
 		return nil, nil
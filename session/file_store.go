@@ -0,0 +1,329 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	acp "github.com/rokku-c/acp-go"
+)
+
+const fileStoreExt = ".jsonl"
+
+// FileStore 以每个会话一个 JSONL 文件的形式持久化会话与更新历史。
+//
+// 文件只追加写入：每次 Save 追加一条会话记录，每次 Append 追加一条更新记录，
+// 每条记录写入后都会 fsync。进程崩溃留下的不完整末行会在下次访问时被截掉。
+// 过期的会话记录累积到阈值后，文件会被重写到临时文件再原子替换。
+type FileStore struct {
+	dir          string
+	compactAfter int
+
+	mu    sync.Mutex
+	stale map[acp.SessionID]int
+}
+
+// FileStoreOption 配置 FileStore。
+type FileStoreOption func(*FileStore)
+
+// WithCompactThreshold 指定过期会话记录达到多少条时自动压缩，默认 64，0 表示不自动压缩。
+func WithCompactThreshold(n int) FileStoreOption {
+	return func(s *FileStore) {
+		s.compactAfter = n
+	}
+}
+
+// NewFileStore 创建以 dir 为目录的存储，目录不存在时会被创建。
+func NewFileStore(dir string, opts ...FileStoreOption) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("session: create store dir: %w", err)
+	}
+	s := &FileStore{
+		dir:          dir,
+		compactAfter: 64,
+		stale:        make(map[acp.SessionID]int),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s, nil
+}
+
+// fileRecord 是会话文件中的一行，两个字段中有且仅有一个非 nil。
+type fileRecord struct {
+	Session *Session                 `json:"session,omitempty"`
+	Update  *acp.SessionNotification `json:"update,omitempty"`
+}
+
+func (s *FileStore) path(id acp.SessionID) string {
+	return filepath.Join(s.dir, url.PathEscape(string(id))+fileStoreExt)
+}
+
+// Load 实现 SessionStore。
+func (s *FileStore) Load(_ context.Context, id acp.SessionID) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, _, _, err := s.read(id)
+	return session, err
+}
+
+// Save 实现 SessionStore。
+func (s *FileStore) Save(_ context.Context, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, known := s.stale[session.ID]; !known {
+		// 首次访问时从文件中统计已有的过期记录数。
+		_, _, stale, err := s.read(session.ID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		s.stale[session.ID] = stale
+		if errors.Is(err, ErrNotFound) {
+			s.stale[session.ID] = -1
+		}
+	}
+	if err := s.append(session.ID, fileRecord{Session: &session}); err != nil {
+		return err
+	}
+	s.stale[session.ID]++
+	if s.compactAfter > 0 && s.stale[session.ID] >= s.compactAfter {
+		return s.compact(session.ID)
+	}
+	return nil
+}
+
+// Delete 实现 SessionStore，删除不存在的会话不会报错。
+func (s *FileStore) Delete(_ context.Context, id acp.SessionID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.stale, id)
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List 实现 SessionStore，按创建时间排序。
+func (s *FileStore) List(_ context.Context) ([]Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []Session
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, fileStoreExt) {
+			continue
+		}
+		id, err := url.PathUnescape(strings.TrimSuffix(name, fileStoreExt))
+		if err != nil {
+			continue
+		}
+		session, _, _, err := s.read(acp.SessionID(id))
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, session)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out, nil
+}
+
+// Append 实现 HistoryStore。
+func (s *FileStore) Append(_ context.Context, id acp.SessionID, note acp.SessionNotification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(s.path(id)); errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return s.append(id, fileRecord{Update: &note})
+}
+
+// History 实现 HistoryStore。
+func (s *FileStore) History(_ context.Context, id acp.SessionID) ([]acp.SessionNotification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, history, _, err := s.read(id)
+	return history, err
+}
+
+// Compact 重写会话文件，只保留最新的会话记录与全部更新记录。
+func (s *FileStore) Compact(_ context.Context, id acp.SessionID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compact(id)
+}
+
+// read 读取会话文件，返回最新的会话记录、更新历史与过期会话记录数。
+// 无法解析的末行视为崩溃留下的残缺写入并被忽略。
+func (s *FileStore) read(id acp.SessionID) (Session, []acp.SessionNotification, int, error) {
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Session{}, nil, 0, ErrNotFound
+	}
+	if err != nil {
+		return Session{}, nil, 0, err
+	}
+
+	var (
+		session  *Session
+		history  []acp.SessionNotification
+		sessions int
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var record fileRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			if !bytes.HasSuffix(data, []byte("\n")) && bytes.HasSuffix(data, scanner.Bytes()) {
+				break
+			}
+			return Session{}, nil, 0, fmt.Errorf("session: %s line %d: %w", s.path(id), line, err)
+		}
+		switch {
+		case record.Session != nil:
+			session = record.Session
+			sessions++
+		case record.Update != nil:
+			history = append(history, *record.Update)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Session{}, nil, 0, err
+	}
+	if session == nil {
+		return Session{}, nil, 0, ErrNotFound
+	}
+	return *session, history, sessions - 1, nil
+}
+
+// append 追加一条记录并 fsync，追加前截掉不完整的末行。
+func (s *FileStore) append(id acp.SessionID, record fileRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	f, err := os.OpenFile(s.path(id), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := truncatePartialLine(f); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// truncatePartialLine 在文件不以换行结尾时截断到最后一个换行之后。
+func truncatePartialLine(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, size-1); err != nil {
+		return err
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+	data := make([]byte, size)
+	if _, err := f.ReadAt(data, 0); err != nil {
+		return err
+	}
+	return f.Truncate(int64(bytes.LastIndexByte(data, '\n') + 1))
+}
+
+// compact 将压缩后的内容写入临时文件，fsync 后原子替换原文件。
+func (s *FileStore) compact(id acp.SessionID) error {
+	session, history, _, err := s.read(id)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".compact-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(fileRecord{Session: &session}); err != nil {
+		tmp.Close()
+		return err
+	}
+	for i := range history {
+		if err := enc.Encode(fileRecord{Update: &history[i]}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path(id)); err != nil {
+		return err
+	}
+	s.stale[id] = 0
+	return syncDir(s.dir)
+}
+
+// syncDir 确保目录项的变更（如 rename）落盘。
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return err
+	}
+	return nil
+}
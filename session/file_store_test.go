@@ -0,0 +1,152 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	acp "github.com/rokku-c/acp-go"
+)
+
+func textUpdate(id acp.SessionID, text string) acp.SessionNotification {
+	block := acp.NewTextContentBlock(text)
+	return acp.SessionNotification{
+		SessionID: id,
+		Update:    acp.SessionUpdate{Type: acp.SessionUpdateTypeAgentMessageChunk, Content: &block},
+	}
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("new store failed: %v", err)
+	}
+
+	if err := store.Append(ctx, "s/1", textUpdate("s/1", "orphan")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for unknown session, got %v", err)
+	}
+	created := time.Unix(100, 0).UTC()
+	if err := store.Save(ctx, Session{ID: "s/1", CWD: "/a", CreatedAt: created}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	for _, text := range []string{"one", "two"} {
+		if err := store.Append(ctx, "s/1", textUpdate("s/1", text)); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	if err := store.Save(ctx, Session{ID: "s/1", CWD: "/b", CreatedAt: created}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	// 重新打开目录，模拟进程重启。
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	s, err := reopened.Load(ctx, "s/1")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if s.CWD != "/b" || !s.CreatedAt.Equal(created) {
+		t.Fatalf("unexpected session %+v", s)
+	}
+	history, err := reopened.History(ctx, "s/1")
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if len(history) != 2 || history[0].Update.Content.Text != "one" || history[1].Update.Content.Text != "two" {
+		t.Fatalf("unexpected history %+v", history)
+	}
+
+	list, err := reopened.List(ctx)
+	if err != nil || len(list) != 1 || list[0].ID != "s/1" {
+		t.Fatalf("unexpected list %+v (%v)", list, err)
+	}
+
+	if err := reopened.Delete(ctx, "s/1"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := reopened.Load(ctx, "s/1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestFileStoreRecoversFromPartialWrite(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("new store failed: %v", err)
+	}
+	if err := store.Save(ctx, Session{ID: "s", CWD: "/a"}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if err := store.Append(ctx, "s", textUpdate("s", "kept")); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+
+	// 模拟写入一半时崩溃。
+	f, err := os.OpenFile(store.path("s"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if _, err := f.WriteString(`{"update":{"sessionId":"s","upd`); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	f.Close()
+
+	history, err := store.History(ctx, "s")
+	if err != nil || len(history) != 1 {
+		t.Fatalf("expected partial line to be ignored, got %+v (%v)", history, err)
+	}
+	if err := store.Append(ctx, "s", textUpdate("s", "after")); err != nil {
+		t.Fatalf("append after crash failed: %v", err)
+	}
+	history, err = store.History(ctx, "s")
+	if err != nil || len(history) != 2 || history[1].Update.Content.Text != "after" {
+		t.Fatalf("unexpected history after recovery %+v (%v)", history, err)
+	}
+}
+
+func TestFileStoreCompaction(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir(), WithCompactThreshold(3))
+	if err != nil {
+		t.Fatalf("new store failed: %v", err)
+	}
+	if err := store.Save(ctx, Session{ID: "s", CWD: "/0"}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if err := store.Append(ctx, "s", textUpdate("s", "hello")); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	for _, cwd := range []string{"/1", "/2", "/3"} {
+		if err := store.Save(ctx, Session{ID: "s", CWD: cwd}); err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(store.path("s"))
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 2 {
+		t.Fatalf("expected compacted file with 2 lines, got %d:\n%s", lines, data)
+	}
+	s, err := store.Load(ctx, "s")
+	if err != nil || s.CWD != "/3" {
+		t.Fatalf("unexpected session after compaction %+v (%v)", s, err)
+	}
+	history, err := store.History(ctx, "s")
+	if err != nil || len(history) != 1 {
+		t.Fatalf("history lost during compaction %+v (%v)", history, err)
+	}
+	entries, _ := os.ReadDir(store.dir)
+	if len(entries) != 1 {
+		t.Fatalf("expected temp files to be cleaned up, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,78 @@
+package session
+
+import (
+	"context"
+	"errors"
+
+	acp "github.com/rokku-c/acp-go"
+)
+
+// HistoryStore 是可以保存会话更新历史的 SessionStore。
+//
+// Append 在会话不存在时返回 ErrNotFound，History 按追加顺序返回更新。
+type HistoryStore interface {
+	SessionStore
+	Append(ctx context.Context, id acp.SessionID, note acp.SessionNotification) error
+	History(ctx context.Context, id acp.SessionID) ([]acp.SessionNotification, error)
+}
+
+type replayContextKey struct{}
+
+// RecordHistory 返回记录出站 session/update 的拦截器，需通过
+// acp.WithOutboundInterceptors 安装在 AgentSideConnection 上。
+//
+// 存储未实现 HistoryStore 时拦截器不做任何事；未由 Manager 管理的会话会被忽略。
+// 保存失败不影响发送结果，只通过 WithLogger 指定的日志器记录。
+func (m *Manager) RecordHistory() acp.UnaryInterceptor {
+	return func(ctx context.Context, info acp.CallInfo, params any, next acp.Invoker) (any, error) {
+		resp, err := next(ctx, params)
+		if err != nil || info.Method != acp.ClientMethods.SessionUpdate || ctx.Value(replayContextKey{}) != nil {
+			return resp, err
+		}
+		history, ok := m.store.(HistoryStore)
+		if !ok {
+			return resp, nil
+		}
+		note, ok := params.(acp.SessionNotification)
+		if !ok {
+			return resp, nil
+		}
+		if err := history.Append(ctx, note.SessionID, note); err != nil && !errors.Is(err, ErrNotFound) {
+			// 更新已经发给客户端，返回错误会让调用方重发，只记录日志。
+			m.logger.Warn("session: record history", "session", string(note.SessionID), "error", err)
+		}
+		return resp, nil
+	}
+}
+
+// History 返回会话的更新历史，存储未实现 HistoryStore 时返回 nil。
+func (m *Manager) History(ctx context.Context, id acp.SessionID) ([]acp.SessionNotification, error) {
+	history, ok := m.store.(HistoryStore)
+	if !ok {
+		return nil, nil
+	}
+	notes, err := history.History(ctx, id)
+	if err != nil {
+		return nil, unknownSession(id, err)
+	}
+	return notes, nil
+}
+
+// replay 通过 ctx 中的客户端连接按顺序重放会话历史，ctx 中没有连接时直接返回。
+func (m *Manager) replay(ctx context.Context, id acp.SessionID) error {
+	client, ok := acp.ClientFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	notes, err := m.History(ctx, id)
+	if err != nil {
+		return err
+	}
+	ctx = context.WithValue(ctx, replayContextKey{}, true)
+	for _, note := range notes {
+		if err := client.SessionNotification(ctx, note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	acp "github.com/rokku-c/acp-go"
+)
+
+type echoAgent struct {
+	sessionAgent
+}
+
+func (echoAgent) Prompt(ctx context.Context, req acp.PromptRequest) (acp.PromptResponse, error) {
+	client, _ := acp.ClientFromContext(ctx)
+	for _, block := range req.Prompt {
+		if err := client.SessionNotification(ctx, textUpdate(req.SessionID, block.Text)); err != nil {
+			return acp.PromptResponse{}, err
+		}
+	}
+	return acp.PromptResponse{StopReason: acp.StopReasonEndTurn}, nil
+}
+
+type recordingClient struct {
+	acp.UnimplementedClient
+	mu    sync.Mutex
+	texts []string
+}
+
+func (c *recordingClient) SessionNotification(_ context.Context, note acp.SessionNotification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if note.Update.Content != nil {
+		c.texts = append(c.texts, note.Update.Content.Text)
+	}
+	return nil
+}
+
+func (c *recordingClient) received() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.texts...)
+}
+
+func connect(t *testing.T, agent acp.Agent, client acp.Client, agentOpts ...acp.ConnectionOption) *acp.ClientSideConnection {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	c2aR, c2aW := io.Pipe()
+	a2cR, a2cW := io.Pipe()
+	clientConn := acp.NewClientSideConnection(ctx, client, c2aW, a2cR)
+	agentConn := acp.NewAgentSideConnection(ctx, agent, a2cW, c2aR, agentOpts...)
+	t.Cleanup(func() {
+		cancel()
+		clientConn.Close()
+		agentConn.Close()
+		c2aW.Close()
+		a2cW.Close()
+	})
+	return clientConn
+}
+
+func TestLoadSessionReplaysHistory(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("new store failed: %v", err)
+	}
+	m := NewManager(WithStore(store))
+	agent := echoAgent{sessionAgent{m}}
+
+	first := &recordingClient{}
+	conn := connect(t, agent, first, acp.WithOutboundInterceptors(m.RecordHistory()))
+	resp, err := conn.NewSession(ctx, acp.NewSessionRequest{CWD: "/tmp"})
+	if err != nil {
+		t.Fatalf("new session failed: %v", err)
+	}
+	prompt := []acp.ContentBlock{acp.NewTextContentBlock("a"), acp.NewTextContentBlock("b")}
+	if _, err := conn.Prompt(ctx, acp.PromptRequest{SessionID: resp.SessionID, Prompt: prompt}); err != nil {
+		t.Fatalf("prompt failed: %v", err)
+	}
+
+	// 新的客户端连接加载会话，响应返回前应已收到全部历史。
+	second := &recordingClient{}
+	reloaded := NewManager(WithStore(store))
+	conn = connect(t, echoAgent{sessionAgent{reloaded}}, second, acp.WithOutboundInterceptors(reloaded.RecordHistory()))
+	if _, err := conn.LoadSession(ctx, acp.LoadSessionRequest{SessionID: resp.SessionID, CWD: "/tmp"}); err != nil {
+		t.Fatalf("load session failed: %v", err)
+	}
+	got := second.received()
+	if len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Fatalf("unexpected replay %v", got)
+	}
+
+	history, err := reloaded.History(ctx, resp.SessionID)
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("replayed updates must not be recorded again, got %d entries", len(history))
+	}
+}
+
+type failingHistoryStore struct {
+	SessionStore
+}
+
+func (failingHistoryStore) Append(context.Context, acp.SessionID, acp.SessionNotification) error {
+	return errors.New("disk full")
+}
+
+func (failingHistoryStore) History(context.Context, acp.SessionID) ([]acp.SessionNotification, error) {
+	return nil, nil
+}
+
+func TestRecordHistoryFailureDoesNotFailSend(t *testing.T) {
+	var logs bytes.Buffer
+	m := NewManager(WithStore(failingHistoryStore{NewMemoryStore()}), WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	sent := false
+	_, err := m.RecordHistory()(context.Background(), acp.CallInfo{Method: acp.ClientMethods.SessionUpdate, Notification: true}, textUpdate("s", "hi"), func(context.Context, any) (any, error) {
+		sent = true
+		return nil, nil
+	})
+	if err != nil || !sent {
+		t.Fatalf("expected send to succeed, got sent=%v err=%v", sent, err)
+	}
+	if !strings.Contains(logs.String(), "disk full") {
+		t.Fatalf("expected persistence failure to be logged, got %q", logs.String())
+	}
+}
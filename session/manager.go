@@ -0,0 +1,271 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	acp "github.com/rokku-c/acp-go"
+)
+
+// Manager 实现 Agent 中与会话簿记相关的方法：NewSession、LoadSession、
+// SetSessionMode 与 SetSessionModel。
+//
+// 同一会话上的修改通过按会话的锁串行执行，持久化交给 SessionStore。
+type Manager struct {
+	store  SessionStore
+	newID  func() acp.SessionID
+	modes  *acp.SessionModeState
+	models *acp.SessionModelState
+	now    func() time.Time
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	locks map[acp.SessionID]*sessionLock
+}
+
+// sessionLock 是按会话的互斥锁，refs 记录持有与等待者数量，归零时从 locks 中移除。
+type sessionLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// Option 配置 Manager。
+type Option func(*Manager)
+
+// WithStore 指定会话存储，默认使用 NewMemoryStore。
+func WithStore(store SessionStore) Option {
+	return func(m *Manager) {
+		m.store = store
+	}
+}
+
+// WithIDGenerator 指定会话 ID 的生成方式，默认使用 NewID。
+func WithIDGenerator(gen func() acp.SessionID) Option {
+	return func(m *Manager) {
+		m.newID = gen
+	}
+}
+
+// WithModes 指定新会话可用的模式及默认模式。
+func WithModes(modes acp.SessionModeState) Option {
+	return func(m *Manager) {
+		m.modes = &modes
+	}
+}
+
+// WithModels 指定新会话可用的模型及默认模型。
+func WithModels(models acp.SessionModelState) Option {
+	return func(m *Manager) {
+		m.models = &models
+	}
+}
+
+// WithLogger 指定记录后台错误（如保存会话历史失败）的日志器，默认不输出。
+func WithLogger(logger *slog.Logger) Option {
+	return func(m *Manager) {
+		m.logger = logger
+	}
+}
+
+// NewManager 创建 Manager。
+func NewManager(opts ...Option) *Manager {
+	m := &Manager{
+		newID: NewID,
+		now:   time.Now,
+		locks: make(map[acp.SessionID]*sessionLock),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(m)
+		}
+	}
+	if m.store == nil {
+		m.store = NewMemoryStore()
+	}
+	if m.logger == nil {
+		m.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return m
+}
+
+// Store 返回 Manager 使用的会话存储。
+func (m *Manager) Store() SessionStore {
+	return m.store
+}
+
+// NewSession 创建会话并返回其模式与模型状态。
+func (m *Manager) NewSession(ctx context.Context, req acp.NewSessionRequest) (acp.NewSessionResponse, error) {
+	if err := req.Validate(); err != nil {
+		return acp.NewSessionResponse{}, acp.InvalidParams().WithData(err)
+	}
+	id := m.newID()
+	if _, err := m.store.Load(ctx, id); err == nil {
+		return acp.NewSessionResponse{}, fmt.Errorf("session: generated id %q already exists", id)
+	} else if !errors.Is(err, ErrNotFound) {
+		return acp.NewSessionResponse{}, err
+	}
+
+	now := m.now()
+	s := Session{
+		ID:         id,
+		CWD:        filepath.Clean(req.CWD),
+		McpServers: req.McpServers,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if m.modes != nil {
+		modes := *m.modes
+		s.Modes = &modes
+	}
+	if m.models != nil {
+		models := *m.models
+		s.Models = &models
+	}
+	s = s.Clone()
+	if err := m.store.Save(ctx, s); err != nil {
+		return acp.NewSessionResponse{}, err
+	}
+	return acp.NewSessionResponse{SessionID: id, Modes: s.Modes, Models: s.Models}, nil
+}
+
+// LoadSession 恢复已有会话，并以请求中的 cwd 与 MCP 服务替换原有配置。
+//
+// 存储实现 HistoryStore 且 ctx 来自 AgentSideConnection 的处理器时，
+// 会在响应前通过 session/update 按顺序重放会话历史。
+func (m *Manager) LoadSession(ctx context.Context, req acp.LoadSessionRequest) (acp.LoadSessionResponse, error) {
+	if err := req.Validate(); err != nil {
+		return acp.LoadSessionResponse{}, acp.InvalidParams().WithData(err)
+	}
+	var resp acp.LoadSessionResponse
+	err := m.Update(ctx, req.SessionID, func(s *Session) error {
+		s.CWD = filepath.Clean(req.CWD)
+		s.McpServers = append([]acp.McpServer(nil), req.McpServers...)
+		resp.Modes = s.Modes
+		resp.Models = s.Models
+		return nil
+	})
+	if err != nil {
+		return acp.LoadSessionResponse{}, err
+	}
+	if err := m.replay(ctx, req.SessionID); err != nil {
+		return acp.LoadSessionResponse{}, err
+	}
+	return resp, nil
+}
+
+// SetSessionMode 切换会话模式，模式必须在会话声明的 AvailableModes 中。
+func (m *Manager) SetSessionMode(ctx context.Context, req acp.SetSessionModeRequest) (acp.SetSessionModeResponse, error) {
+	err := m.Update(ctx, req.SessionID, func(s *Session) error {
+		if s.Modes == nil {
+			return acp.InvalidParams().WithData("session does not support modes")
+		}
+		for _, mode := range s.Modes.AvailableModes {
+			if mode.ID == req.ModeID {
+				s.Modes.CurrentModeID = req.ModeID
+				return nil
+			}
+		}
+		return acp.InvalidParams().WithData(fmt.Sprintf("unknown mode %q", req.ModeID))
+	})
+	return acp.SetSessionModeResponse{}, err
+}
+
+// SetSessionModel 切换会话模型，模型必须在会话声明的 AvailableModels 中。
+func (m *Manager) SetSessionModel(ctx context.Context, req acp.SetSessionModelRequest) (acp.SetSessionModelResponse, error) {
+	err := m.Update(ctx, req.SessionID, func(s *Session) error {
+		if s.Models == nil {
+			return acp.InvalidParams().WithData("session does not support models")
+		}
+		for _, model := range s.Models.AvailableModels {
+			if model.ModelID == req.ModelID {
+				s.Models.CurrentModelID = req.ModelID
+				return nil
+			}
+		}
+		return acp.InvalidParams().WithData(fmt.Sprintf("unknown model %q", req.ModelID))
+	})
+	return acp.SetSessionModelResponse{}, err
+}
+
+// Get 返回会话的拷贝，会话不存在时返回 InvalidParams。
+func (m *Manager) Get(ctx context.Context, id acp.SessionID) (Session, error) {
+	s, err := m.store.Load(ctx, id)
+	if err != nil {
+		return Session{}, unknownSession(id, err)
+	}
+	return s, nil
+}
+
+// List 返回所有会话。
+func (m *Manager) List(ctx context.Context) ([]Session, error) {
+	return m.store.List(ctx)
+}
+
+// Update 在会话锁内读取、修改并保存会话；fn 返回错误时不会保存。
+func (m *Manager) Update(ctx context.Context, id acp.SessionID, fn func(*Session) error) error {
+	// 先确认会话存在，未知 ID 不必竞争锁。
+	if _, err := m.store.Load(ctx, id); err != nil {
+		return unknownSession(id, err)
+	}
+	unlock := m.Lock(id)
+	defer unlock()
+
+	s, err := m.store.Load(ctx, id)
+	if err != nil {
+		return unknownSession(id, err)
+	}
+	if err := fn(&s); err != nil {
+		return err
+	}
+	s.ID = id
+	s.UpdatedAt = m.now()
+	return m.store.Save(ctx, s)
+}
+
+// Delete 删除会话。
+func (m *Manager) Delete(ctx context.Context, id acp.SessionID) error {
+	unlock := m.Lock(id)
+	defer unlock()
+	return m.store.Delete(ctx, id)
+}
+
+// Lock 获取会话的互斥锁并返回解锁函数，用于串行化同一会话上的操作。
+//
+// 锁只在有持有者或等待者时存在，最后一个持有者解锁后即被回收。
+func (m *Manager) Lock(id acp.SessionID) func() {
+	m.mu.Lock()
+	l, ok := m.locks[id]
+	if !ok {
+		l = &sessionLock{}
+		m.locks[id] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+
+	l.mu.Lock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Unlock()
+			m.mu.Lock()
+			l.refs--
+			if l.refs == 0 {
+				delete(m.locks, id)
+			}
+			m.mu.Unlock()
+		})
+	}
+}
+
+func unknownSession(id acp.SessionID, err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return acp.InvalidParams().WithData(fmt.Sprintf("unknown session %q", id))
+	}
+	return err
+}
@@ -0,0 +1,211 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	acp "github.com/rokku-c/acp-go"
+)
+
+// sessionAgent 演示如何将 Manager 嵌入 Agent 实现。
+type sessionAgent struct {
+	*Manager
+}
+
+func (sessionAgent) Initialize(context.Context, acp.InitializeRequest) (acp.InitializeResponse, error) {
+	return acp.InitializeResponse{}, nil
+}
+
+func (sessionAgent) Authenticate(context.Context, acp.AuthenticateRequest) (acp.AuthenticateResponse, error) {
+	return acp.AuthenticateResponse{}, nil
+}
+
+func (sessionAgent) Prompt(context.Context, acp.PromptRequest) (acp.PromptResponse, error) {
+	return acp.PromptResponse{StopReason: acp.StopReasonEndTurn}, nil
+}
+
+func (sessionAgent) Cancel(context.Context, acp.CancelNotification) error { return nil }
+
+func (sessionAgent) ExtMethod(context.Context, acp.ExtRequest) (acp.ExtResponse, error) {
+	return nil, nil
+}
+
+func (sessionAgent) ExtNotification(context.Context, acp.ExtNotification) error { return nil }
+
+var _ acp.Agent = sessionAgent{}
+
+func testManager(opts ...Option) *Manager {
+	base := []Option{
+		WithModes(acp.SessionModeState{
+			CurrentModeID: "ask",
+			AvailableModes: []acp.SessionMode{
+				{ID: "ask", Name: "Ask"},
+				{ID: "code", Name: "Code"},
+			},
+		}),
+		WithModels(acp.SessionModelState{
+			CurrentModelID:  "small",
+			AvailableModels: []acp.ModelInfo{{ModelID: "small", Name: "Small"}, {ModelID: "large", Name: "Large"}},
+		}),
+	}
+	return NewManager(append(base, opts...)...)
+}
+
+func TestManagerNewSession(t *testing.T) {
+	ctx := context.Background()
+	m := testManager(WithIDGenerator(func() acp.SessionID { return "s1" }))
+
+	resp, err := m.NewSession(ctx, acp.NewSessionRequest{CWD: "/work/../repo"})
+	if err != nil {
+		t.Fatalf("new session failed: %v", err)
+	}
+	if resp.SessionID != "s1" || resp.Modes == nil || resp.Modes.CurrentModeID != "ask" || resp.Models == nil {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+
+	s, err := m.Get(ctx, "s1")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if s.CWD != "/repo" || s.CreatedAt.IsZero() {
+		t.Fatalf("unexpected session %+v", s)
+	}
+
+	if _, err := m.NewSession(ctx, acp.NewSessionRequest{CWD: "relative"}); !errors.Is(err, acp.ErrInvalidParams) {
+		t.Fatalf("expected invalid params for relative cwd, got %v", err)
+	}
+	if _, err := m.NewSession(ctx, acp.NewSessionRequest{CWD: "/tmp"}); err == nil {
+		t.Fatalf("expected error on duplicate generated id")
+	}
+}
+
+func TestManagerSetModeAndModel(t *testing.T) {
+	ctx := context.Background()
+	m := testManager()
+	resp, err := m.NewSession(ctx, acp.NewSessionRequest{CWD: "/tmp"})
+	if err != nil {
+		t.Fatalf("new session failed: %v", err)
+	}
+	id := resp.SessionID
+
+	if _, err := m.SetSessionMode(ctx, acp.SetSessionModeRequest{SessionID: id, ModeID: "code"}); err != nil {
+		t.Fatalf("set mode failed: %v", err)
+	}
+	if _, err := m.SetSessionMode(ctx, acp.SetSessionModeRequest{SessionID: id, ModeID: "yolo"}); !errors.Is(err, acp.ErrInvalidParams) {
+		t.Fatalf("expected invalid params for unknown mode, got %v", err)
+	}
+	if _, err := m.SetSessionModel(ctx, acp.SetSessionModelRequest{SessionID: id, ModelID: "large"}); err != nil {
+		t.Fatalf("set model failed: %v", err)
+	}
+	if _, err := m.SetSessionModel(ctx, acp.SetSessionModelRequest{SessionID: id, ModelID: "huge"}); !errors.Is(err, acp.ErrInvalidParams) {
+		t.Fatalf("expected invalid params for unknown model, got %v", err)
+	}
+	if _, err := m.SetSessionMode(ctx, acp.SetSessionModeRequest{SessionID: "missing", ModeID: "code"}); !errors.Is(err, acp.ErrInvalidParams) {
+		t.Fatalf("expected invalid params for unknown session, got %v", err)
+	}
+
+	s, err := m.Get(ctx, id)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if s.Modes.CurrentModeID != "code" || s.Models.CurrentModelID != "large" {
+		t.Fatalf("unexpected state %+v %+v", s.Modes, s.Models)
+	}
+
+	other, err := m.NewSession(ctx, acp.NewSessionRequest{CWD: "/tmp"})
+	if err != nil {
+		t.Fatalf("new session failed: %v", err)
+	}
+	if other.Modes.CurrentModeID != "ask" {
+		t.Fatalf("mode change leaked into new session: %+v", other.Modes)
+	}
+}
+
+func TestManagerLoadSession(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	m := testManager(WithStore(store))
+	resp, err := m.NewSession(ctx, acp.NewSessionRequest{CWD: "/a"})
+	if err != nil {
+		t.Fatalf("new session failed: %v", err)
+	}
+
+	// 另一个 Manager 共享同一存储，模拟进程重启后恢复会话。
+	restarted := NewManager(WithStore(store))
+	servers := []acp.McpServer{acp.NewMcpServerStdio(acp.McpServerStdio{Name: "fs", Command: "mcp-fs"})}
+	loaded, err := restarted.LoadSession(ctx, acp.LoadSessionRequest{SessionID: resp.SessionID, CWD: "/b", McpServers: servers})
+	if err != nil {
+		t.Fatalf("load session failed: %v", err)
+	}
+	if loaded.Modes == nil || loaded.Modes.CurrentModeID != "ask" {
+		t.Fatalf("unexpected load response %+v", loaded)
+	}
+	s, _ := restarted.Get(ctx, resp.SessionID)
+	if s.CWD != "/b" || len(s.McpServers) != 1 {
+		t.Fatalf("load did not update session: %+v", s)
+	}
+
+	if _, err := restarted.LoadSession(ctx, acp.LoadSessionRequest{SessionID: "missing", CWD: "/b"}); !errors.Is(err, acp.ErrInvalidParams) {
+		t.Fatalf("expected invalid params for unknown session, got %v", err)
+	}
+}
+
+func TestManagerUpdateIsSerialized(t *testing.T) {
+	ctx := context.Background()
+	m := testManager()
+	resp, err := m.NewSession(ctx, acp.NewSessionRequest{CWD: "/tmp"})
+	if err != nil {
+		t.Fatalf("new session failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = m.Update(ctx, resp.SessionID, func(s *Session) error {
+				s.McpServers = append(s.McpServers, acp.NewMcpServerStdio(acp.McpServerStdio{Name: "x", Command: "x"}))
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	s, _ := m.Get(ctx, resp.SessionID)
+	if len(s.McpServers) != 50 {
+		t.Fatalf("expected 50 servers after concurrent updates, got %d", len(s.McpServers))
+	}
+
+	if err := m.Delete(ctx, resp.SessionID); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := m.Get(ctx, resp.SessionID); !errors.Is(err, acp.ErrInvalidParams) {
+		t.Fatalf("expected unknown session after delete, got %v", err)
+	}
+}
+
+func TestManagerLocksAreReclaimed(t *testing.T) {
+	ctx := context.Background()
+	m := testManager()
+
+	if err := m.Update(ctx, "missing", func(*Session) error { return nil }); !errors.Is(err, acp.ErrInvalidParams) {
+		t.Fatalf("expected invalid params for unknown session, got %v", err)
+	}
+
+	unlock := m.Lock("s")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Lock("s")()
+	}()
+	unlock()
+	<-done
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.locks) != 0 {
+		t.Fatalf("expected no lock entries after release, got %d", len(m.locks))
+	}
+}
@@ -0,0 +1,80 @@
+// Package session 为代理侧提供会话簿记：会话 ID、工作目录、MCP 服务、
+// 当前模式与模型，以及按会话加锁的状态更新。
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"time"
+
+	acp "github.com/rokku-c/acp-go"
+)
+
+// Session 描述代理侧保存的会话状态。
+type Session struct {
+	ID         acp.SessionID          `json:"id"`
+	CWD        string                 `json:"cwd"`
+	McpServers []acp.McpServer        `json:"mcpServers,omitempty"`
+	Modes      *acp.SessionModeState  `json:"modes,omitempty"`
+	Models     *acp.SessionModelState `json:"models,omitempty"`
+	CreatedAt  time.Time              `json:"createdAt"`
+	UpdatedAt  time.Time              `json:"updatedAt"`
+}
+
+// Clone 返回会话的深拷贝，调用方修改拷贝不会影响原会话。
+func (s Session) Clone() Session {
+	out := s
+	if s.McpServers != nil {
+		out.McpServers = make([]acp.McpServer, len(s.McpServers))
+		for i, server := range s.McpServers {
+			out.McpServers[i] = cloneMcpServer(server)
+		}
+	}
+	if s.Modes != nil {
+		modes := *s.Modes
+		modes.AvailableModes = append([]acp.SessionMode(nil), s.Modes.AvailableModes...)
+		out.Modes = &modes
+	}
+	if s.Models != nil {
+		models := *s.Models
+		models.AvailableModels = append([]acp.ModelInfo(nil), s.Models.AvailableModels...)
+		out.Models = &models
+	}
+	return out
+}
+
+// cloneMcpServer 复制 MCP 服务配置及其变体指向的数据。
+func cloneMcpServer(server acp.McpServer) acp.McpServer {
+	var out acp.McpServer
+	if server.Stdio != nil {
+		stdio := *server.Stdio
+		stdio.Args = slices.Clone(stdio.Args)
+		stdio.Env = slices.Clone(stdio.Env)
+		stdio.Meta = slices.Clone(stdio.Meta)
+		out.Stdio = &stdio
+	}
+	if server.HTTP != nil {
+		http := *server.HTTP
+		http.Headers = slices.Clone(http.Headers)
+		http.Meta = slices.Clone(http.Meta)
+		out.HTTP = &http
+	}
+	if server.SSE != nil {
+		sse := *server.SSE
+		sse.Headers = slices.Clone(sse.Headers)
+		sse.Meta = slices.Clone(sse.Meta)
+		out.SSE = &sse
+	}
+	return out
+}
+
+// NewID 生成随机的会话 ID。
+func NewID() acp.SessionID {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("session: generate id: %v", err))
+	}
+	return acp.SessionID("sess_" + hex.EncodeToString(b[:]))
+}
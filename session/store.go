@@ -0,0 +1,104 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	acp "github.com/rokku-c/acp-go"
+)
+
+// ErrNotFound 表示会话不存在。
+var ErrNotFound = errors.New("session: not found")
+
+// SessionStore 负责会话的持久化，实现需要可以被并发调用。
+//
+// Load 在会话不存在时返回 ErrNotFound。
+type SessionStore interface {
+	Load(ctx context.Context, id acp.SessionID) (Session, error)
+	Save(ctx context.Context, s Session) error
+	Delete(ctx context.Context, id acp.SessionID) error
+	List(ctx context.Context) ([]Session, error)
+}
+
+// MemoryStore 将会话及其更新历史保存在内存中。
+type MemoryStore struct {
+	mu       sync.RWMutex
+	sessions map[acp.SessionID]Session
+	history  map[acp.SessionID][]acp.SessionNotification
+}
+
+// NewMemoryStore 创建空的内存存储。
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[acp.SessionID]Session),
+		history:  make(map[acp.SessionID][]acp.SessionNotification),
+	}
+}
+
+// Load 实现 SessionStore。
+func (m *MemoryStore) Load(_ context.Context, id acp.SessionID) (Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return Session{}, ErrNotFound
+	}
+	return s.Clone(), nil
+}
+
+// Save 实现 SessionStore。
+func (m *MemoryStore) Save(_ context.Context, s Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[s.ID] = s.Clone()
+	return nil
+}
+
+// Delete 实现 SessionStore，删除不存在的会话不会报错。
+func (m *MemoryStore) Delete(_ context.Context, id acp.SessionID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	delete(m.history, id)
+	return nil
+}
+
+// List 实现 SessionStore，按创建时间排序。
+func (m *MemoryStore) List(_ context.Context) ([]Session, error) {
+	m.mu.RLock()
+	out := make([]Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		out = append(out, s.Clone())
+	}
+	m.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out, nil
+}
+
+// Append 实现 HistoryStore。
+func (m *MemoryStore) Append(_ context.Context, id acp.SessionID, note acp.SessionNotification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[id]; !ok {
+		return ErrNotFound
+	}
+	m.history[id] = append(m.history[id], note)
+	return nil
+}
+
+// History 实现 HistoryStore。
+func (m *MemoryStore) History(_ context.Context, id acp.SessionID) ([]acp.SessionNotification, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.sessions[id]; !ok {
+		return nil, ErrNotFound
+	}
+	return append([]acp.SessionNotification(nil), m.history[id]...), nil
+}
@@ -0,0 +1,69 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	acp "github.com/rokku-c/acp-go"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	if _, err := store.Load(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	base := time.Unix(100, 0)
+	modes := &acp.SessionModeState{CurrentModeID: "ask", AvailableModes: []acp.SessionMode{{ID: "ask"}}}
+	if err := store.Save(ctx, Session{ID: "b", CreatedAt: base.Add(time.Second), Modes: modes}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if err := store.Save(ctx, Session{ID: "a", CreatedAt: base}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	// 修改调用方持有的数据不应影响已保存的会话。
+	modes.CurrentModeID = "code"
+	modes.AvailableModes[0].ID = "code"
+	s, err := store.Load(ctx, "b")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if s.Modes.CurrentModeID != "ask" || s.Modes.AvailableModes[0].ID != "ask" {
+		t.Fatalf("stored session was mutated: %+v", s.Modes)
+	}
+
+	list, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(list) != 2 || list[0].ID != "a" || list[1].ID != "b" {
+		t.Fatalf("unexpected list order %+v", list)
+	}
+
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := store.Load(ctx, "a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestSessionCloneCopiesMcpServers(t *testing.T) {
+	s := Session{McpServers: []acp.McpServer{
+		acp.NewMcpServerStdio(acp.McpServerStdio{Name: "a", Command: "a", Args: []string{"x"}}),
+		acp.NewMcpServerHTTP(acp.McpServerHTTP{Name: "b", URL: "http://b", Headers: []acp.HttpHeader{{Name: "k", Value: "v"}}}),
+	}}
+	out := s.Clone()
+	out.McpServers[0].Stdio.Args[0] = "y"
+	out.McpServers[1].HTTP.URL = "http://c"
+	out.McpServers[1].HTTP.Headers[0].Value = "w"
+
+	if s.McpServers[0].Stdio.Args[0] != "x" || s.McpServers[1].HTTP.URL != "http://b" || s.McpServers[1].HTTP.Headers[0].Value != "v" {
+		t.Fatalf("clone shares MCP server data with original: %+v %+v", s.McpServers[0].Stdio, s.McpServers[1].HTTP)
+	}
+}
@@ -0,0 +1,161 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// SessionSender 向单个会话发送 session/update 通知。
+//
+// SessionSender 绑定创建时传入的 ctx，通常在 Prompt 处理器中通过
+// AgentSideConnection.SessionSender 获取，并在处理器返回前使用完毕。
+type SessionSender struct {
+	ctx       context.Context
+	conn      *AgentSideConnection
+	sessionID SessionID
+}
+
+// SessionSender 返回绑定到会话 id 的 SessionSender。
+func (c *AgentSideConnection) SessionSender(ctx context.Context, id SessionID) *SessionSender {
+	return &SessionSender{ctx: ctx, conn: c, sessionID: id}
+}
+
+// SessionID 返回 SessionSender 绑定的会话。
+func (s *SessionSender) SessionID() SessionID {
+	return s.sessionID
+}
+
+// Send 发送任意会话更新。
+func (s *SessionSender) Send(update SessionUpdate) error {
+	return s.conn.SessionNotification(s.ctx, SessionNotification{SessionID: s.sessionID, Update: update})
+}
+
+// AgentText 发送一段代理回复文本。
+func (s *SessionSender) AgentText(text string) error {
+	return s.AgentContent(NewTextContentBlock(text))
+}
+
+// AgentContent 发送一段代理回复内容，例如图片或资源链接。
+func (s *SessionSender) AgentContent(block ContentBlock) error {
+	return s.Send(SessionUpdate{Type: SessionUpdateTypeAgentMessageChunk, Content: &block})
+}
+
+// Thought 发送一段代理思考文本。
+func (s *SessionSender) Thought(text string) error {
+	block := NewTextContentBlock(text)
+	return s.Send(SessionUpdate{Type: SessionUpdateTypeAgentThoughtChunk, Content: &block})
+}
+
+// UserText 发送一段用户消息文本，通常用于重放历史。
+func (s *SessionSender) UserText(text string) error {
+	block := NewTextContentBlock(text)
+	return s.Send(SessionUpdate{Type: SessionUpdateTypeUserMessageChunk, Content: &block})
+}
+
+// StartToolCall 通知客户端开始一次工具调用。
+func (s *SessionSender) StartToolCall(call ToolCall) error {
+	return s.Send(SessionUpdate{Type: SessionUpdateTypeToolCall, ToolCall: &call})
+}
+
+// UpdateToolCall 更新工具调用的状态或输出。
+func (s *SessionSender) UpdateToolCall(update ToolCallUpdate) error {
+	return s.Send(SessionUpdate{Type: SessionUpdateTypeToolCallUpdate, ToolCallUpdate: &update})
+}
+
+// Plan 发送完整的执行计划，客户端应以此替换之前的计划。
+func (s *SessionSender) Plan(entries []PlanEntry) error {
+	return s.Send(SessionUpdate{Type: SessionUpdateTypePlan, Entries: entries})
+}
+
+// AvailableCommands 发送当前可用的命令列表。
+func (s *SessionSender) AvailableCommands(commands []AvailableCommand) error {
+	return s.Send(SessionUpdate{Type: SessionUpdateTypeAvailableCommands, AvailableCommands: commands})
+}
+
+// CurrentMode 通知客户端会话模式已切换。
+func (s *SessionSender) CurrentMode(id SessionModeID) error {
+	return s.Send(SessionUpdate{Type: SessionUpdateTypeCurrentMode, CurrentModeID: id})
+}
+
+// Writer 返回将写入内容作为 agent_message_chunk 发送的 TextWriter。
+func (s *SessionSender) Writer() *TextWriter {
+	return &TextWriter{send: s.AgentText}
+}
+
+var errWriterClosed = errors.New("acp: text writer closed")
+
+// TextWriter 是把文本流转换为消息分片的 io.WriteCloser。
+//
+// 每次 Write 发送一个分片，被截断在末尾的不完整 UTF-8 字符会留到下次写入；
+// Flush 与 Close 发送剩余内容。需要合并小写入时可以再包一层 bufio.Writer。
+type TextWriter struct {
+	mu      sync.Mutex
+	send    func(string) error
+	pending []byte
+	closed  bool
+}
+
+// Write 实现 io.Writer。
+func (w *TextWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, errWriterClosed
+	}
+	w.pending = append(w.pending, p...)
+	n := completeUTF8Prefix(w.pending)
+	if n == 0 {
+		return len(p), nil
+	}
+	text := string(w.pending[:n])
+	w.pending = append(w.pending[:0], w.pending[n:]...)
+	if err := w.send(text); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush 发送缓冲中剩余的字节，不完整的字符会被替换为 U+FFFD。
+func (w *TextWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flush()
+}
+
+func (w *TextWriter) flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	text := strings.ToValidUTF8(string(w.pending), string(utf8.RuneError))
+	w.pending = w.pending[:0]
+	return w.send(text)
+}
+
+// Close 发送剩余内容，之后的 Write 返回错误。
+func (w *TextWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.flush()
+}
+
+// completeUTF8Prefix 返回 b 中不以被截断字符结尾的最长前缀长度。
+func completeUTF8Prefix(b []byte) int {
+	end := len(b)
+	// 最多回看 utf8.UTFMax-1 个字节寻找未完成字符的起始字节。
+	for i := end - 1; i >= 0 && i >= end-utf8.UTFMax+1; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:end]) {
+				return i
+			}
+			break
+		}
+	}
+	return end
+}
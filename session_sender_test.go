@@ -0,0 +1,119 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSessionSenderEmitsUpdates(t *testing.T) {
+	agent := &mockAgent{}
+	agent.promptFunc = func(ctx context.Context, req PromptRequest) (PromptResponse, error) {
+		client, _ := ClientFromContext(ctx)
+		s := client.SessionSender(ctx, req.SessionID)
+		steps := []error{
+			s.UserText("question"),
+			s.Thought("thinking"),
+			s.AgentText("answer"),
+			s.StartToolCall(ToolCall{ID: "t1", Name: "read"}),
+			s.UpdateToolCall(ToolCallUpdate{ID: "t1", Status: ToolCallStatusCompleted}),
+			s.Plan([]PlanEntry{{Content: "step", Priority: PlanEntryPriorityHigh, Status: PlanEntryStatusPending}}),
+			s.AvailableCommands(nil),
+			s.CurrentMode("code"),
+		}
+		for _, err := range steps {
+			if err != nil {
+				return PromptResponse{}, err
+			}
+		}
+		return PromptResponse{StopReason: StopReasonEndTurn}, nil
+	}
+	client := &mockClient{sessionUpdateCh: make(chan SessionNotification, 16)}
+	_, clientConn := connectPair(t, agent, client, nil)
+
+	if _, err := clientConn.Prompt(context.Background(), PromptRequest{SessionID: "s", Prompt: []ContentBlock{NewTextContentBlock("hi")}}); err != nil {
+		t.Fatalf("prompt failed: %v", err)
+	}
+	close(client.sessionUpdateCh)
+
+	var got []string
+	for note := range client.sessionUpdateCh {
+		if note.SessionID != "s" {
+			t.Fatalf("unexpected session id %q", note.SessionID)
+		}
+		u := note.Update
+		switch u.Type {
+		case SessionUpdateTypeUserMessageChunk, SessionUpdateTypeAgentThoughtChunk, SessionUpdateTypeAgentMessageChunk:
+			got = append(got, fmt.Sprintf("%s:%s", u.Type, u.Content.Text))
+		case SessionUpdateTypeToolCall:
+			got = append(got, fmt.Sprintf("%s:%s", u.Type, u.ToolCall.ID))
+		case SessionUpdateTypeToolCallUpdate:
+			got = append(got, fmt.Sprintf("%s:%s", u.Type, u.ToolCallUpdate.Status))
+		case SessionUpdateTypePlan:
+			got = append(got, fmt.Sprintf("%s:%d", u.Type, len(u.Entries)))
+		case SessionUpdateTypeAvailableCommands:
+			got = append(got, fmt.Sprintf("%s:%d", u.Type, len(u.AvailableCommands)))
+		case SessionUpdateTypeCurrentMode:
+			got = append(got, fmt.Sprintf("%s:%s", u.Type, u.CurrentModeID))
+		}
+	}
+	want := []string{
+		"user_message_chunk:question",
+		"agent_thought_chunk:thinking",
+		"agent_message_chunk:answer",
+		"tool_call:t1",
+		"tool_call_update:completed",
+		"plan:1",
+		"available_commands_update:0",
+		"current_mode_update:code",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected updates:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestSessionUpdateAlwaysCarriesLists(t *testing.T) {
+	data, err := json.Marshal(SessionUpdate{Type: SessionUpdateTypePlan})
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if string(data) != `{"sessionUpdate":"plan","entries":[]}` {
+		t.Fatalf("unexpected plan json %s", data)
+	}
+	data, _ = json.Marshal(SessionUpdate{Type: SessionUpdateTypeAvailableCommands})
+	if string(data) != `{"sessionUpdate":"available_commands_update","availableCommands":[]}` {
+		t.Fatalf("unexpected commands json %s", data)
+	}
+}
+
+func TestTextWriterKeepsRunesIntact(t *testing.T) {
+	var chunks []string
+	w := &TextWriter{send: func(text string) error {
+		chunks = append(chunks, text)
+		return nil
+	}}
+
+	data := []byte("héllo 世界")
+	// 在多字节字符中间切开写入。
+	for _, part := range [][]byte{data[:2], data[2:9], data[9:]} {
+		if n, err := w.Write(part); err != nil || n != len(part) {
+			t.Fatalf("write returned %d, %v", n, err)
+		}
+	}
+	if _, err := w.Write([]byte{0xe4}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if _, err := w.Write([]byte("x")); err == nil {
+		t.Fatalf("expected error writing after close")
+	}
+
+	want := []string{"h", "éllo ", "世界", "�"}
+	if strings.Join(chunks, "|") != strings.Join(want, "|") {
+		t.Fatalf("unexpected chunks %q", chunks)
+	}
+}
@@ -0,0 +1,315 @@
+package acp
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// MessageRole 表示会话消息的来源。
+type MessageRole string
+
+const (
+	MessageRoleUser    MessageRole = "user"
+	MessageRoleAgent   MessageRole = "agent"
+	MessageRoleThought MessageRole = "thought"
+)
+
+// SessionMessage 是由连续的消息分片合并得到的一条消息。
+type SessionMessage struct {
+	Role    MessageRole
+	Content []ContentBlock
+}
+
+// Text 返回消息中所有文本内容的拼接。
+func (m SessionMessage) Text() string {
+	var b strings.Builder
+	for _, block := range m.Content {
+		if block.Type == ContentBlockTypeText {
+			b.WriteString(block.Text)
+		}
+	}
+	return b.String()
+}
+
+// ToolCallState 描述一次工具调用的当前状态。
+type ToolCallState struct {
+	ID     string
+	Name   string
+	Input  json.RawMessage
+	Status ToolCallStatus
+	Output json.RawMessage
+	// StatusHistory 按时间顺序记录出现过的状态，相邻的重复状态只记录一次。
+	StatusHistory []ToolCallStatus
+	// Turn 为工具调用首次出现时所在轮次的下标。
+	Turn int
+}
+
+// SessionTurn 是一个对话轮次：以用户消息开始，包含其后代理的消息与工具调用。
+// 首条用户消息之前出现的内容归入第一个轮次。
+type SessionTurn struct {
+	Messages []SessionMessage
+	// ToolCallIDs 为本轮次中出现的工具调用，按首次出现的顺序排列。
+	ToolCallIDs []string
+}
+
+// SessionSnapshot 是某一时刻会话状态的只读拷贝。
+type SessionSnapshot struct {
+	SessionID SessionID
+	// Messages 为所有轮次的消息按顺序拼接的结果。
+	Messages []SessionMessage
+	Turns    []SessionTurn
+	// ToolCalls 按首次出现的顺序排列。
+	ToolCalls     []ToolCallState
+	Plan          []PlanEntry
+	Commands      []AvailableCommand
+	CurrentModeID SessionModeID
+}
+
+// ToolCall 按 id 查找工具调用。
+func (s SessionSnapshot) ToolCall(id string) (ToolCallState, bool) {
+	for _, call := range s.ToolCalls {
+		if call.ID == id {
+			return call, true
+		}
+	}
+	return ToolCallState{}, false
+}
+
+// SessionChange 描述一次 Apply 引起的变化。
+type SessionChange struct {
+	Update SessionUpdate
+	// MessageIndex 为受影响消息的下标，非消息更新时为 -1。
+	MessageIndex int
+	// ToolCallID 为受影响的工具调用，非工具调用更新时为空。
+	ToolCallID string
+	// Turn 为受影响消息或工具调用所在轮次的下标，其他更新时为 -1。
+	Turn int
+}
+
+// SessionChangeFunc 在会话状态变化后被调用，调用顺序与 Apply 的顺序一致。
+type SessionChangeFunc func(SessionChange)
+
+// SessionState 将 session/update 通知折叠为会话状态，可以被并发使用。
+//
+// 典型用法是在 Client.SessionNotification 中调用 Apply，并通过 Snapshot
+// 或 Subscribe 驱动界面。
+type SessionState struct {
+	id SessionID
+
+	mu        sync.Mutex
+	messages  []SessionMessage
+	toolCalls []ToolCallState
+	toolIndex map[string]int
+	plan      []PlanEntry
+	commands  []AvailableCommand
+	mode      SessionModeID
+	turns     []turnState
+	// split 表示下一个分片应开始新消息，在工具调用开始后置位。
+	split bool
+
+	// notifyMu 保证回调按 Apply 的顺序执行，且不持有 mu。
+	notifyMu sync.Mutex
+	nextSub  int
+	subs     []subscription
+}
+
+// turnState 记录轮次的首条消息下标及其工具调用，replied 表示轮次中已有代理输出。
+type turnState struct {
+	firstMessage int
+	toolCalls    []string
+	replied      bool
+}
+
+type subscription struct {
+	id int
+	fn SessionChangeFunc
+}
+
+// NewSessionState 创建会话 id 的空状态。
+func NewSessionState(id SessionID) *SessionState {
+	return &SessionState{
+		id:        id,
+		toolIndex: make(map[string]int),
+	}
+}
+
+// Subscribe 注册变化回调并返回取消函数，回调按注册顺序执行。
+// 回调中可以调用 Snapshot，但不能调用 Apply 或 Subscribe。
+func (s *SessionState) Subscribe(fn SessionChangeFunc) func() {
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	id := s.nextSub
+	s.nextSub++
+	s.subs = append(s.subs, subscription{id: id, fn: fn})
+	return func() {
+		s.notifyMu.Lock()
+		defer s.notifyMu.Unlock()
+		for i, sub := range s.subs {
+			if sub.id == id {
+				s.subs = append(s.subs[:i], s.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Apply 折叠一条通知，返回是否改变了状态。其他会话的通知与未知类型会被忽略。
+func (s *SessionState) Apply(note SessionNotification) bool {
+	if note.SessionID != s.id {
+		return false
+	}
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+
+	s.mu.Lock()
+	change, ok := s.apply(note.Update)
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+	for _, sub := range s.subs {
+		sub.fn(change)
+	}
+	return true
+}
+
+func (s *SessionState) apply(u SessionUpdate) (SessionChange, bool) {
+	change := SessionChange{Update: u, MessageIndex: -1, Turn: -1}
+	switch u.Type {
+	case SessionUpdateTypeUserMessageChunk:
+		change.MessageIndex, change.Turn = s.appendChunk(MessageRoleUser, u.Content)
+	case SessionUpdateTypeAgentMessageChunk:
+		change.MessageIndex, change.Turn = s.appendChunk(MessageRoleAgent, u.Content)
+	case SessionUpdateTypeAgentThoughtChunk:
+		change.MessageIndex, change.Turn = s.appendChunk(MessageRoleThought, u.Content)
+	case SessionUpdateTypeToolCall:
+		if u.ToolCall == nil {
+			return change, false
+		}
+		s.split = true
+		call := s.toolCall(u.ToolCall.ID)
+		call.Name = u.ToolCall.Name
+		call.Input = u.ToolCall.Input
+		if call.Status == "" {
+			call.setStatus(ToolCallStatusPending)
+		}
+		change.ToolCallID = call.ID
+		change.Turn = call.Turn
+	case SessionUpdateTypeToolCallUpdate:
+		if u.ToolCallUpdate == nil {
+			return change, false
+		}
+		call := s.toolCall(u.ToolCallUpdate.ID)
+		if u.ToolCallUpdate.Status != "" {
+			call.setStatus(u.ToolCallUpdate.Status)
+		}
+		if len(u.ToolCallUpdate.Output) > 0 {
+			call.Output = u.ToolCallUpdate.Output
+		}
+		change.ToolCallID = call.ID
+		change.Turn = call.Turn
+	case SessionUpdateTypePlan:
+		s.plan = append([]PlanEntry(nil), u.Entries...)
+	case SessionUpdateTypeAvailableCommands:
+		s.commands = append([]AvailableCommand(nil), u.AvailableCommands...)
+	case SessionUpdateTypeCurrentMode:
+		s.mode = u.CurrentModeID
+	default:
+		return change, false
+	}
+	return change, true
+}
+
+// appendChunk 将分片合并进同角色的最后一条消息；角色不同或中间出现过工具调用时开始新消息。
+// 代理输出之后的用户消息开始新的轮次。返回消息与轮次的下标。
+func (s *SessionState) appendChunk(role MessageRole, block *ContentBlock) (int, int) {
+	last := len(s.messages) - 1
+	if last < 0 || s.messages[last].Role != role || s.split {
+		if role == MessageRoleUser {
+			if n := len(s.turns); n == 0 || s.turns[n-1].replied {
+				s.turns = append(s.turns, turnState{firstMessage: len(s.messages)})
+			}
+		}
+		s.messages = append(s.messages, SessionMessage{Role: role})
+		last++
+		s.split = false
+	}
+	turn := s.currentTurn()
+	if role != MessageRoleUser {
+		turn.replied = true
+	}
+	if block == nil {
+		return last, len(s.turns) - 1
+	}
+	msg := &s.messages[last]
+	if n := len(msg.Content); n > 0 && block.Type == ContentBlockTypeText && msg.Content[n-1].Type == ContentBlockTypeText {
+		msg.Content[n-1].Text += block.Text
+	} else {
+		msg.Content = append(msg.Content, *block)
+	}
+	return last, len(s.turns) - 1
+}
+
+// currentTurn 返回最后一个轮次，还没有轮次时创建第一个。
+func (s *SessionState) currentTurn() *turnState {
+	if len(s.turns) == 0 {
+		s.turns = append(s.turns, turnState{})
+	}
+	return &s.turns[len(s.turns)-1]
+}
+
+// toolCall 返回 id 对应的工具调用，不存在时在当前轮次中创建。
+func (s *SessionState) toolCall(id string) *ToolCallState {
+	if i, ok := s.toolIndex[id]; ok {
+		return &s.toolCalls[i]
+	}
+	turn := s.currentTurn()
+	turn.toolCalls = append(turn.toolCalls, id)
+	turn.replied = true
+	s.toolIndex[id] = len(s.toolCalls)
+	s.toolCalls = append(s.toolCalls, ToolCallState{ID: id, Turn: len(s.turns) - 1})
+	return &s.toolCalls[len(s.toolCalls)-1]
+}
+
+func (c *ToolCallState) setStatus(status ToolCallStatus) {
+	c.Status = status
+	if n := len(c.StatusHistory); n == 0 || c.StatusHistory[n-1] != status {
+		c.StatusHistory = append(c.StatusHistory, status)
+	}
+}
+
+// Snapshot 返回当前状态的深拷贝。
+func (s *SessionState) Snapshot() SessionSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := SessionSnapshot{
+		SessionID:     s.id,
+		Messages:      make([]SessionMessage, len(s.messages)),
+		Turns:         make([]SessionTurn, len(s.turns)),
+		ToolCalls:     make([]ToolCallState, len(s.toolCalls)),
+		Plan:          append([]PlanEntry(nil), s.plan...),
+		Commands:      append([]AvailableCommand(nil), s.commands...),
+		CurrentModeID: s.mode,
+	}
+	for i, msg := range s.messages {
+		snap.Messages[i] = SessionMessage{Role: msg.Role, Content: append([]ContentBlock(nil), msg.Content...)}
+	}
+	for i, call := range s.toolCalls {
+		call.Input = append(json.RawMessage(nil), call.Input...)
+		call.Output = append(json.RawMessage(nil), call.Output...)
+		call.StatusHistory = append([]ToolCallStatus(nil), call.StatusHistory...)
+		snap.ToolCalls[i] = call
+	}
+	for i, turn := range s.turns {
+		end := len(snap.Messages)
+		if i+1 < len(s.turns) {
+			end = s.turns[i+1].firstMessage
+		}
+		snap.Turns[i] = SessionTurn{
+			Messages:    snap.Messages[turn.firstMessage:end:end],
+			ToolCallIDs: append([]string(nil), turn.toolCalls...),
+		}
+	}
+	return snap
+}
@@ -0,0 +1,146 @@
+package acp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func chunk(kind SessionUpdateType, text string) SessionNotification {
+	block := NewTextContentBlock(text)
+	return SessionNotification{SessionID: "s", Update: SessionUpdate{Type: kind, Content: &block}}
+}
+
+func TestSessionStateReducesUpdates(t *testing.T) {
+	state := NewSessionState("s")
+	var changes []SessionChange
+	unsubscribe := state.Subscribe(func(c SessionChange) {
+		changes = append(changes, c)
+		_ = state.Snapshot()
+	})
+
+	notes := []SessionNotification{
+		chunk(SessionUpdateTypeUserMessageChunk, "hello"),
+		chunk(SessionUpdateTypeAgentThoughtChunk, "hm"),
+		chunk(SessionUpdateTypeAgentMessageChunk, "Hi "),
+		chunk(SessionUpdateTypeAgentMessageChunk, "there"),
+		{SessionID: "s", Update: SessionUpdate{Type: SessionUpdateTypeToolCall, ToolCall: &ToolCall{ID: "t1", Name: "read"}}},
+		{SessionID: "s", Update: SessionUpdate{Type: SessionUpdateTypeToolCallUpdate, ToolCallUpdate: &ToolCallUpdate{ID: "t1", Status: ToolCallStatusInProgress}}},
+		{SessionID: "s", Update: SessionUpdate{Type: SessionUpdateTypeToolCallUpdate, ToolCallUpdate: &ToolCallUpdate{ID: "t1", Status: ToolCallStatusInProgress}}},
+		{SessionID: "s", Update: SessionUpdate{Type: SessionUpdateTypeToolCallUpdate, ToolCallUpdate: &ToolCallUpdate{ID: "t1", Status: ToolCallStatusCompleted, Output: json.RawMessage(`"ok"`)}}},
+		chunk(SessionUpdateTypeAgentMessageChunk, "done"),
+		{SessionID: "s", Update: SessionUpdate{Type: SessionUpdateTypePlan, Entries: []PlanEntry{{Content: "a"}}}},
+		{SessionID: "s", Update: SessionUpdate{Type: SessionUpdateTypeAvailableCommands, AvailableCommands: []AvailableCommand{{Name: "test"}}}},
+		{SessionID: "s", Update: SessionUpdate{Type: SessionUpdateTypeCurrentMode, CurrentModeID: "code"}},
+	}
+	for _, note := range notes {
+		if !state.Apply(note) {
+			t.Fatalf("expected update %s to be applied", note.Update.Type)
+		}
+	}
+	if state.Apply(inSession(chunk(SessionUpdateTypeAgentMessageChunk, "x"), "other")) {
+		t.Fatalf("updates for other sessions must be ignored")
+	}
+
+	snap := state.Snapshot()
+	wantMessages := []struct {
+		role MessageRole
+		text string
+	}{
+		{MessageRoleUser, "hello"},
+		{MessageRoleThought, "hm"},
+		{MessageRoleAgent, "Hi there"},
+		{MessageRoleAgent, "done"},
+	}
+	if len(snap.Messages) != len(wantMessages) {
+		t.Fatalf("unexpected messages %+v", snap.Messages)
+	}
+	for i, want := range wantMessages {
+		if snap.Messages[i].Role != want.role || snap.Messages[i].Text() != want.text {
+			t.Fatalf("message %d = %s %q, want %s %q", i, snap.Messages[i].Role, snap.Messages[i].Text(), want.role, want.text)
+		}
+	}
+
+	call, ok := snap.ToolCall("t1")
+	if !ok || call.Name != "read" || call.Status != ToolCallStatusCompleted || string(call.Output) != `"ok"` {
+		t.Fatalf("unexpected tool call %+v", call)
+	}
+	if len(call.StatusHistory) != 3 || call.StatusHistory[0] != ToolCallStatusPending || call.StatusHistory[1] != ToolCallStatusInProgress {
+		t.Fatalf("unexpected status history %v", call.StatusHistory)
+	}
+	if len(snap.Plan) != 1 || len(snap.Commands) != 1 || snap.CurrentModeID != "code" {
+		t.Fatalf("unexpected plan/commands/mode %+v", snap)
+	}
+
+	if len(changes) != len(notes) {
+		t.Fatalf("expected %d change events, got %d", len(notes), len(changes))
+	}
+	if changes[3].MessageIndex != 2 || changes[4].ToolCallID != "t1" || changes[9].MessageIndex != -1 {
+		t.Fatalf("unexpected change events %+v", changes)
+	}
+
+	// 快照不应受后续更新影响。
+	snap.Messages[0].Content[0].Text = "mutated"
+	unsubscribe()
+	state.Apply(chunk(SessionUpdateTypeAgentMessageChunk, "!"))
+	if got := state.Snapshot(); got.Messages[0].Text() != "hello" || got.Messages[3].Text() != "done!" {
+		t.Fatalf("snapshot is not isolated: %+v", got.Messages)
+	}
+	if len(changes) != len(notes) {
+		t.Fatalf("unsubscribed callback was called")
+	}
+}
+
+func inSession(note SessionNotification, id SessionID) SessionNotification {
+	note.SessionID = id
+	return note
+}
+
+func TestSessionStateGroupsTurns(t *testing.T) {
+	state := NewSessionState("s")
+	var order []int
+	for i := 0; i < 5; i++ {
+		i := i
+		state.Subscribe(func(SessionChange) { order = append(order, i) })
+	}
+
+	var changes []SessionChange
+	state.Subscribe(func(c SessionChange) { changes = append(changes, c) })
+	for _, note := range []SessionNotification{
+		chunk(SessionUpdateTypeUserMessageChunk, "first"),
+		chunk(SessionUpdateTypeAgentMessageChunk, "a"),
+		{SessionID: "s", Update: SessionUpdate{Type: SessionUpdateTypeToolCall, ToolCall: &ToolCall{ID: "t1"}}},
+		chunk(SessionUpdateTypeUserMessageChunk, "second"),
+		chunk(SessionUpdateTypeUserMessageChunk, " part"),
+		chunk(SessionUpdateTypeAgentMessageChunk, "b"),
+		{SessionID: "s", Update: SessionUpdate{Type: SessionUpdateTypeToolCallUpdate, ToolCallUpdate: &ToolCallUpdate{ID: "t1", Status: ToolCallStatusCompleted}}},
+	} {
+		state.Apply(note)
+	}
+
+	snap := state.Snapshot()
+	if len(snap.Turns) != 2 {
+		t.Fatalf("expected 2 turns, got %+v", snap.Turns)
+	}
+	first, second := snap.Turns[0], snap.Turns[1]
+	if len(first.Messages) != 2 || first.Messages[0].Text() != "first" || first.Messages[1].Text() != "a" {
+		t.Fatalf("unexpected first turn %+v", first)
+	}
+	if len(first.ToolCallIDs) != 1 || first.ToolCallIDs[0] != "t1" {
+		t.Fatalf("unexpected first turn tool calls %v", first.ToolCallIDs)
+	}
+	if len(second.Messages) != 2 || second.Messages[0].Text() != "second part" || len(second.ToolCallIDs) != 0 {
+		t.Fatalf("unexpected second turn %+v", second)
+	}
+	if call, _ := snap.ToolCall("t1"); call.Turn != 0 {
+		t.Fatalf("tool call should stay in its first turn, got %d", call.Turn)
+	}
+	if changes[3].Turn != 1 || changes[6].Turn != 0 {
+		t.Fatalf("unexpected change turns %+v", changes)
+	}
+
+	for i, got := range order[:5] {
+		if got != i {
+			t.Fatalf("callbacks ran out of registration order: %v", order)
+		}
+	}
+}
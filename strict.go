@@ -0,0 +1,168 @@
+package acp
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// WithStrictDecoding 启用严格解码：拒绝未知字段（_meta 除外），
+// 并调用请求类型的 Validate 方法。失败时返回 InvalidParams，
+// data 为指向出错字段的 ValidationError。
+func WithStrictDecoding() ConnectionOption {
+	return func(o *connectionOptions) {
+		o.strict = true
+	}
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	fieldCheckerType    = reflect.TypeOf((*strictFieldChecker)(nil)).Elem()
+)
+
+// strictFieldChecker 由自定义 UnmarshalJSON 的对象类型实现，按线上格式检查未知字段。
+// 未实现的自定义类型（如 RequestID、ProtocolVersion）视为标量，不做检查。
+type strictFieldChecker interface {
+	checkFields(raw json.RawMessage, pointer string) *ValidationError
+}
+
+// decodeStrict 严格解码参数并执行校验。
+func decodeStrict[T any](params json.RawMessage) (T, error) {
+	var zero T
+	if len(bytes.TrimSpace(params)) == 0 {
+		return zero, InvalidParams().WithData("params must not be empty")
+	}
+	if err := checkUnknownFields(params, reflect.TypeOf(zero), ""); err != nil {
+		return zero, InvalidParams().WithData(err)
+	}
+	if err := json.Unmarshal(params, &zero); err != nil {
+		return zero, InvalidParams().WithData(err.Error())
+	}
+	if v, ok := any(zero).(validator); ok {
+		if err := v.Validate(); err != nil {
+			if fieldErr, ok := err.(*ValidationError); ok {
+				return zero, InvalidParams().WithData(fieldErr)
+			}
+			return zero, InvalidParams().WithData(&ValidationError{Message: err.Error()})
+		}
+	}
+	return zero, nil
+}
+
+// checkUnknownFields 对照 Go 类型遍历 JSON，找出第一个未知字段。
+// 类型不匹配留给 json.Unmarshal 报告。
+func checkUnknownFields(raw json.RawMessage, t reflect.Type, pointer string) *ValidationError {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(fieldCheckerType) {
+		return reflect.New(t).Interface().(strictFieldChecker).checkFields(raw, pointer)
+	}
+	if t.Implements(jsonUnmarshalerType) || reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return checkObjectFields(raw, t, pointer)
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil
+		}
+		for i, item := range items {
+			if err := checkUnknownFields(item, t.Elem(), jsonPointer(pointer, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		var items map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil
+		}
+		for key, item := range items {
+			if err := checkUnknownFields(item, t.Elem(), jsonPointer(pointer, key)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkObjectFields(raw json.RawMessage, t reflect.Type, pointer string, extra ...string) *ValidationError {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil
+	}
+	fields := jsonFields(t)
+	for key, value := range object {
+		if key == "_meta" || contains(extra, key) {
+			continue
+		}
+		field, ok := fields[key]
+		if !ok {
+			return &ValidationError{Pointer: jsonPointer(pointer, key), Message: "unknown field"}
+		}
+		if err := checkUnknownFields(value, field, jsonPointer(pointer, key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonFields 返回结构体按 json 标签命名的字段类型，包括匿名嵌入的字段。
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for k, v := range jsonFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func contains(values []string, v string) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFields 按 type 选择的变体检查 MCP 服务配置的字段。
+func (s *McpServer) checkFields(raw json.RawMessage, pointer string) *ValidationError {
+	var server McpServer
+	if err := json.Unmarshal(raw, &server); err != nil {
+		return nil
+	}
+	switch server.Type() {
+	case McpServerTypeHTTP:
+		return checkObjectFields(raw, reflect.TypeOf(McpServerHTTP{}), pointer, "type")
+	case McpServerTypeSSE:
+		return checkObjectFields(raw, reflect.TypeOf(McpServerSSE{}), pointer, "type")
+	default:
+		return checkObjectFields(raw, reflect.TypeOf(McpServerStdio{}), pointer, "type")
+	}
+}
+
+// checkFields 按平铺的线上格式检查字段。
+func (r *WaitForTerminalExitResponse) checkFields(raw json.RawMessage, pointer string) *ValidationError {
+	return checkObjectFields(raw, reflect.TypeOf(waitForTerminalExitResponseWire{}), pointer)
+}
@@ -0,0 +1,112 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func strictAgentHandler() *agentInboundHandler {
+	return &agentInboundHandler{
+		agent: &testAgent{},
+		opts:  newConnectionOptions([]ConnectionOption{WithStrictDecoding()}),
+	}
+}
+
+func validationData(t *testing.T, errObj Error) ValidationError {
+	t.Helper()
+	if errObj.Code != ErrorCodeInvalidParams.Code {
+		t.Fatalf("expected invalid params, got %+v", errObj)
+	}
+	var data ValidationError
+	if err := json.Unmarshal(errObj.Data, &data); err != nil {
+		t.Fatalf("unexpected data %s: %v", errObj.Data, err)
+	}
+	return data
+}
+
+func TestStrictDecodingRejectsUnknownFields(t *testing.T) {
+	handler := strictAgentHandler()
+	params := json.RawMessage(`{"sessionId":"s","prompt":[{"type":"text","text":"hi","colour":"red"}]}`)
+	_, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.SessionPrompt, params)
+	if data := validationData(t, errObj); data.Pointer != "/prompt/0/colour" {
+		t.Fatalf("unexpected pointer %q", data.Pointer)
+	}
+}
+
+func TestStrictDecodingAllowsMeta(t *testing.T) {
+	handler := strictAgentHandler()
+	params := json.RawMessage(`{"protocolVersion":1,"clientCapabilities":{"fs":{"_meta":{"x":1}}},"clientInfo":{"name":"zed","version":"1","_meta":{}},"_meta":{"trace":"abc"}}`)
+	_, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.Initialize, params)
+	if errObj.Code != 0 {
+		t.Fatalf("unexpected error: %+v", errObj)
+	}
+}
+
+func TestStrictDecodingValidatesRequests(t *testing.T) {
+	handler := strictAgentHandler()
+
+	_, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.SessionNew, mustRawJSON(NewSessionRequest{CWD: "relative/dir"}))
+	if data := validationData(t, errObj); data.Pointer != "/cwd" {
+		t.Fatalf("unexpected pointer %q", data.Pointer)
+	}
+
+	_, errObj, _ = handler.handleRequest(context.Background(), AgentMethods.SessionSetModel, mustRawJSON(SetSessionModelRequest{ModelID: "m"}))
+	if data := validationData(t, errObj); data.Pointer != "/sessionId" {
+		t.Fatalf("unexpected pointer %q", data.Pointer)
+	}
+
+	_, errObj, _ = handler.handleRequest(context.Background(), AgentMethods.SessionNew, mustRawJSON(NewSessionRequest{
+		CWD:        "/work",
+		McpServers: []McpServer{NewMcpServerStdio(McpServerStdio{Name: "fs"})},
+	}))
+	if data := validationData(t, errObj); data.Pointer != "/mcpServers/0" {
+		t.Fatalf("unexpected pointer %q", data.Pointer)
+	}
+}
+
+func TestStrictDecodingRejectsUnknownEnum(t *testing.T) {
+	handler := &clientInboundHandler{
+		client: &testClient{},
+		opts:   newConnectionOptions([]ConnectionOption{WithStrictDecoding()}),
+	}
+	params := mustRawJSON(RequestPermissionRequest{
+		SessionID: "s",
+		ToolCall:  ToolCallUpdate{ID: "tool"},
+		Options:   []PermissionOption{{ID: "allow", Name: "Allow", Kind: "allow_forever"}},
+	})
+	_, errObj, _ := handler.handleRequest(context.Background(), ClientMethods.SessionRequestPermission, params)
+	if data := validationData(t, errObj); data.Pointer != "/options/0/kind" {
+		t.Fatalf("unexpected pointer %q", data.Pointer)
+	}
+}
+
+func TestLenientDecodingByDefault(t *testing.T) {
+	agent := &testAgent{}
+	handler := &agentInboundHandler{agent: agent}
+	params := json.RawMessage(`{"sessionId":"s","modelId":"m","extra":true}`)
+	_, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.SessionSetModel, params)
+	if errObj.Code != 0 || !agent.setModelCalled {
+		t.Fatalf("expected lenient decoding, got %+v", errObj)
+	}
+}
+
+func TestJSONPointerEscaping(t *testing.T) {
+	if got := jsonPointer("/env", 0, "a/b~c"); got != "/env/0/a~1b~0c" {
+		t.Fatalf("unexpected pointer %q", got)
+	}
+}
+
+func TestStrictDecodingChecksCustomUnmarshalers(t *testing.T) {
+	if _, err := decodeStrict[WaitForTerminalExitResponse](json.RawMessage(`{"exitCode":0,"signal":"TERM","_meta":{}}`)); err != nil {
+		t.Fatalf("unexpected error for flat exit status: %v", err)
+	}
+	_, err := decodeStrict[WaitForTerminalExitResponse](json.RawMessage(`{"exitCode":0,"exitStatus":{}}`))
+	errObj, ok := asError(err)
+	if !ok {
+		t.Fatalf("expected protocol error, got %v", err)
+	}
+	if data := validationData(t, errObj); data.Pointer != "/exitStatus" {
+		t.Fatalf("unexpected pointer %q", data.Pointer)
+	}
+}
@@ -0,0 +1,74 @@
+package acp
+
+import (
+	"sync"
+	"unicode/utf8"
+)
+
+// TerminalOutputBuffer 保存终端输出，超出字节上限时从头部截断。
+//
+// 截断总是落在 UTF-8 字符边界上，供 Client 实现 CreateTerminal 与
+// TerminalOutput 时使用。可安全地被多个 goroutine 并发写入。
+type TerminalOutputBuffer struct {
+	mu        sync.Mutex
+	limit     *uint64
+	data      []byte
+	truncated bool
+}
+
+// NewTerminalOutputBuffer 根据 CreateTerminalRequest.OutputByteLimit 创建缓冲区，nil 表示不限制。
+func NewTerminalOutputBuffer(limit *uint64) *TerminalOutputBuffer {
+	b := &TerminalOutputBuffer{}
+	if limit != nil {
+		v := *limit
+		b.limit = &v
+	}
+	return b
+}
+
+// Write 实现 io.Writer，追加输出并在必要时截断。
+func (b *TerminalOutputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append(b.data, p...)
+	b.trim()
+	return len(p), nil
+}
+
+// trim 丢弃超出上限的头部字节，并跳过被截断字符的剩余字节。
+func (b *TerminalOutputBuffer) trim() {
+	if b.limit == nil || uint64(len(b.data)) <= *b.limit {
+		return
+	}
+	drop := len(b.data) - int(*b.limit)
+	for drop < len(b.data) && !utf8.RuneStart(b.data[drop]) {
+		drop++
+	}
+	n := copy(b.data, b.data[drop:])
+	b.data = b.data[:n]
+	b.truncated = true
+}
+
+// Output 返回当前保留的输出以及是否发生过截断。
+func (b *TerminalOutputBuffer) Output() (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.data), b.truncated
+}
+
+// Len 返回当前保留的字节数。
+func (b *TerminalOutputBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.data)
+}
+
+// Response 构造 terminal/output 响应。
+func (b *TerminalOutputBuffer) Response(exitStatus *TerminalExitStatus) TerminalOutputResponse {
+	output, truncated := b.Output()
+	return TerminalOutputResponse{
+		Output:     output,
+		Truncated:  truncated,
+		ExitStatus: exitStatus,
+	}
+}
@@ -0,0 +1,59 @@
+package acp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTerminalOutputBufferUnlimited(t *testing.T) {
+	buf := NewTerminalOutputBuffer(nil)
+	buf.Write([]byte("hello "))
+	buf.Write([]byte("world"))
+	out, truncated := buf.Output()
+	if out != "hello world" || truncated {
+		t.Fatalf("unexpected output %q (truncated=%v)", out, truncated)
+	}
+}
+
+func TestTerminalOutputBufferTruncatesFromStart(t *testing.T) {
+	buf := NewTerminalOutputBuffer(ptr(uint64(5)))
+	buf.Write([]byte("abcdefgh"))
+	resp := buf.Response(nil)
+	if resp.Output != "defgh" || !resp.Truncated {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func TestTerminalOutputBufferTruncatesAtRuneBoundary(t *testing.T) {
+	// "你" 与 "好" 各占 3 字节，上限 4 会切在 "你" 中间。
+	buf := NewTerminalOutputBuffer(ptr(uint64(4)))
+	buf.Write([]byte("你好"))
+	out, truncated := buf.Output()
+	if out != "好" || !truncated {
+		t.Fatalf("unexpected output %q (truncated=%v)", out, truncated)
+	}
+	if buf.Len() != 3 {
+		t.Fatalf("unexpected length %d", buf.Len())
+	}
+}
+
+func TestWaitForTerminalExitResponseFlattened(t *testing.T) {
+	resp := WaitForTerminalExitResponse{
+		ExitStatus: TerminalExitStatus{ExitCode: ptr(uint32(2))},
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if string(data) != `{"exitCode":2}` {
+		t.Fatalf("unexpected json %s", data)
+	}
+
+	var decoded WaitForTerminalExitResponse
+	if err := json.Unmarshal([]byte(`{"exitCode":null,"signal":"SIGKILL"}`), &decoded); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if decoded.ExitStatus.Signal == nil || *decoded.ExitStatus.Signal != "SIGKILL" {
+		t.Fatalf("unexpected exit status %+v", decoded.ExitStatus)
+	}
+}
@@ -0,0 +1,94 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// terminalReclaimTimeout 限制连接关闭时回收终端的总耗时。
+const terminalReclaimTimeout = 5 * time.Second
+
+// terminalKey 标识一个由代理创建的终端。
+type terminalKey struct {
+	session  SessionID
+	terminal TerminalID
+}
+
+// terminalRegistry 记录代理创建后尚未释放的终端。
+type terminalRegistry struct {
+	mu        sync.Mutex
+	terminals map[terminalKey]struct{}
+}
+
+func (r *terminalRegistry) add(session SessionID, terminal TerminalID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.terminals == nil {
+		r.terminals = make(map[terminalKey]struct{})
+	}
+	r.terminals[terminalKey{session, terminal}] = struct{}{}
+}
+
+func (r *terminalRegistry) remove(session SessionID, terminal TerminalID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.terminals, terminalKey{session, terminal})
+}
+
+// take 取出并移除匹配的终端，session 为空时取出全部。
+func (r *terminalRegistry) take(session SessionID) []terminalKey {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []terminalKey
+	for key := range r.terminals {
+		if session == "" || key.session == session {
+			keys = append(keys, key)
+			delete(r.terminals, key)
+		}
+	}
+	return keys
+}
+
+// createTerminal 调用 terminal/create 的处理器并记录成功创建的终端。
+func (h *clientInboundHandler) createTerminal(ctx context.Context, req CreateTerminalRequest, next func(context.Context, CreateTerminalRequest) (CreateTerminalResponse, error)) (CreateTerminalResponse, error) {
+	resp, err := next(ctx, req)
+	if err == nil {
+		h.terminals.add(req.SessionID, resp.TerminalID)
+	}
+	return resp, err
+}
+
+// releaseTerminal 调用 terminal/release 的处理器并在成功后停止跟踪该终端。
+func (h *clientInboundHandler) releaseTerminal(ctx context.Context, req ReleaseTerminalRequest, next func(context.Context, ReleaseTerminalRequest) (ReleaseTerminalResponse, error)) (ReleaseTerminalResponse, error) {
+	resp, err := next(ctx, req)
+	if err == nil {
+		h.terminals.remove(req.SessionID, req.TerminalID)
+	}
+	return resp, err
+}
+
+// reclaimTerminals 对代理未释放的终端调用 Client.ReleaseTerminal，ctx 结束后不再继续。
+func (h *clientInboundHandler) reclaimTerminals(ctx context.Context, session SessionID) error {
+	var errs []error
+	for _, key := range h.terminals.take(session) {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if _, err := h.client.ReleaseTerminal(ctx, ReleaseTerminalRequest{SessionID: key.session, TerminalID: key.terminal}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReleaseSessionTerminals 释放代理在会话 id 中创建但尚未释放的终端。
+//
+// 协议中没有会话结束的消息，客户端无法得知代理何时不再使用某个会话，
+// 因此自动回收只在连接关闭时进行。客户端自己结束会话时应调用此方法，
+// 否则该会话的终端会一直保留到连接关闭。
+func (c *ClientSideConnection) ReleaseSessionTerminals(ctx context.Context, id SessionID) error {
+	return c.handler.reclaimTerminals(ctx, id)
+}
@@ -0,0 +1,84 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+)
+
+type terminalClient struct {
+	mockClient
+	mu       sync.Mutex
+	next     int
+	released []TerminalID
+}
+
+func (c *terminalClient) CreateTerminal(context.Context, CreateTerminalRequest) (CreateTerminalResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.next++
+	return CreateTerminalResponse{TerminalID: TerminalID("term-" + string(rune('0'+c.next)))}, nil
+}
+
+func (c *terminalClient) ReleaseTerminal(_ context.Context, req ReleaseTerminalRequest) (ReleaseTerminalResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.released = append(c.released, req.TerminalID)
+	return ReleaseTerminalResponse{}, nil
+}
+
+func (c *terminalClient) releasedTerminals() []TerminalID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := append([]TerminalID(nil), c.released...)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+func TestClientReclaimsTerminals(t *testing.T) {
+	client := &terminalClient{}
+	agentConn, clientConn := connectPair(t, &mockAgent{}, client, nil)
+	ctx := context.Background()
+	if _, err := clientConn.Initialize(ctx, InitializeRequest{
+		ProtocolVersion:    ProtocolVersionCurrent,
+		ClientCapabilities: ClientCapabilities{Terminal: true},
+	}); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	for _, id := range []SessionID{"a", "a", "b"} {
+		if _, err := agentConn.CreateTerminal(ctx, CreateTerminalRequest{SessionID: id, Command: "true"}); err != nil {
+			t.Fatalf("create terminal failed: %v", err)
+		}
+	}
+	if _, err := agentConn.ReleaseTerminal(ctx, ReleaseTerminalRequest{SessionID: "a", TerminalID: "term-1"}); err != nil {
+		t.Fatalf("release terminal failed: %v", err)
+	}
+
+	if err := clientConn.ReleaseSessionTerminals(ctx, "a"); err != nil {
+		t.Fatalf("release session terminals failed: %v", err)
+	}
+	if got := client.releasedTerminals(); len(got) != 2 || got[0] != "term-1" || got[1] != "term-2" {
+		t.Fatalf("unexpected released terminals after session release: %v", got)
+	}
+
+	clientConn.Close()
+	if got := client.releasedTerminals(); len(got) != 3 || got[2] != "term-3" {
+		t.Fatalf("unreleased terminals were not reclaimed on close: %v", got)
+	}
+}
+
+func TestReclaimTerminalsStopsWhenContextEnds(t *testing.T) {
+	client := &terminalClient{}
+	handler := &clientInboundHandler{client: client}
+	handler.terminals.add("a", "term-1")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := handler.reclaimTerminals(ctx, ""); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context error, got %v", err)
+	}
+	if got := client.releasedTerminals(); len(got) != 0 {
+		t.Fatalf("released terminals after ctx ended: %v", got)
+	}
+}
@@ -0,0 +1,329 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrTurnCancelled 是 prompt 轮次被 session/cancel 取消时 context.Cause 返回的错误。
+var ErrTurnCancelled = errors.New("acp: prompt turn cancelled")
+
+// IsTurnCancelled 判断 Prompt 的 ctx 是否因 session/cancel 而取消。
+func IsTurnCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrTurnCancelled)
+}
+
+// TurnPolicy 决定同一会话上已有进行中的 prompt 轮次时如何处理新的 session/prompt。
+type TurnPolicy int
+
+const (
+	// TurnPolicyReject 以 TurnInProgress 错误拒绝新的轮次，这是默认行为。
+	TurnPolicyReject TurnPolicy = iota
+	// TurnPolicyQueue 让新的轮次排队，等之前的轮次结束后依次执行。
+	TurnPolicyQueue
+	// TurnPolicyCancelPrevious 取消之前的轮次，待其返回后执行新的轮次。
+	TurnPolicyCancelPrevious
+	// TurnPolicyAllow 不加保护，允许同一会话上的轮次并发执行，
+	// 适用于自行处理并发的代理。session/cancel 会取消会话上所有进行中的轮次。
+	TurnPolicyAllow
+)
+
+// WithTurnPolicy 指定同一会话上重叠 prompt 的处理方式，默认为 TurnPolicyReject。
+func WithTurnPolicy(policy TurnPolicy) ConnectionOption {
+	return func(o *connectionOptions) {
+		o.turnPolicy = policy
+	}
+}
+
+// turnTracker 按 TurnPolicy 调度每个会话上的 prompt 轮次，并记录其取消函数。
+type turnTracker struct {
+	mu       sync.Mutex
+	sessions map[SessionID]*sessionTurns
+}
+
+// sessionTurns 是一个会话上的轮次：pending 为已登记但尚未通过请求检查的轮次，
+// 按到达顺序排列；running 为正在执行的轮次；waiting 为排队等待的轮次。
+// 只有 TurnPolicyAllow 会让 running 中同时存在多个轮次。
+type sessionTurns struct {
+	pending []*turn
+	running []*turn
+	waiting []*turn
+}
+
+// turn 是一个 prompt 轮次。轮次在读循环中登记，处理器开始执行时才绑定 ctx；
+// 绑定前收到的取消记录在 cause 中，绑定时立即生效。字段由 turnTracker.mu 保护。
+type turn struct {
+	cancel context.CancelCauseFunc
+	cause  error
+	// head 在轮次成为 pending 中的第一个时关闭，此后才能按策略入场。
+	head  chan struct{}
+	ready chan struct{}
+}
+
+// stop 以 cause 取消轮次，调用方需持有 turnTracker.mu。
+func (tr *turn) stop(cause error) {
+	if tr.cancel != nil {
+		tr.cancel(cause)
+		return
+	}
+	if tr.cause == nil {
+		tr.cause = cause
+	}
+}
+
+// begin 按 policy 为会话开始一个轮次，返回轮次 ctx 与结束函数。
+// 排队期间被取消时，返回的 ctx 已经结束，调用方不应再执行轮次。
+func (t *turnTracker) begin(ctx context.Context, id SessionID, policy TurnPolicy) (context.Context, func(), error) {
+	tr := t.record(id)
+	if err := t.admit(ctx, id, tr, policy); err != nil {
+		return nil, nil, err
+	}
+	ctx, done := t.wait(ctx, id, tr)
+	return ctx, done, nil
+}
+
+// record 登记会话上新到达的轮次，只用于让 session/cancel 能找到它，不应用任何策略。
+func (t *turnTracker) record(id SessionID) *turn {
+	tr := &turn{head: make(chan struct{}), ready: make(chan struct{})}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sessions == nil {
+		t.sessions = make(map[SessionID]*sessionTurns)
+	}
+	st := t.sessions[id]
+	if st == nil {
+		st = &sessionTurns{}
+		t.sessions[id] = st
+	}
+	st.pending = append(st.pending, tr)
+	if len(st.pending) == 1 {
+		close(tr.head)
+	}
+	return tr
+}
+
+// admit 在请求通过检查后按 policy 让已登记的轮次入场：会话空闲时立即开始执行，
+// 否则排队、取消之前的轮次或被拒绝。轮次按登记顺序入场。
+func (t *turnTracker) admit(ctx context.Context, id SessionID, tr *turn, policy TurnPolicy) error {
+	select {
+	case <-tr.head:
+	case <-ctx.Done():
+		t.finish(id, tr)
+		return context.Cause(ctx)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st := t.sessions[id]
+	st.pending = removeTurn(st.pending, tr)
+	if len(st.pending) > 0 {
+		close(st.pending[0].head)
+	}
+	switch {
+	case tr.cause != nil:
+		// 登记后已被取消，不再影响其他轮次，等待时直接结束。
+		t.cleanup(id, st)
+		return nil
+	case len(st.running) == 0 || policy == TurnPolicyAllow:
+		st.running = append(st.running, tr)
+		close(tr.ready)
+		return nil
+	}
+	switch policy {
+	case TurnPolicyQueue:
+	case TurnPolicyCancelPrevious:
+		for _, r := range st.running {
+			r.stop(ErrTurnCancelled)
+		}
+		for _, w := range st.waiting {
+			w.stop(ErrTurnCancelled)
+		}
+	default:
+		t.cleanup(id, st)
+		return TurnInProgress().WithData(fmt.Sprintf("session %q already has a prompt turn in progress", id))
+	}
+	st.waiting = append(st.waiting, tr)
+	return nil
+}
+
+// wait 为已入场的轮次绑定 ctx，并等待轮到它执行或被取消。
+// 等待期间被取消时轮次已经结束，返回的结束函数什么也不做。
+func (t *turnTracker) wait(ctx context.Context, id SessionID, tr *turn) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	t.mu.Lock()
+	tr.cancel = cancel
+	if tr.cause != nil {
+		cancel(tr.cause)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-tr.ready:
+		return ctx, func() { t.finish(id, tr) }
+	case <-ctx.Done():
+		t.finish(id, tr)
+		return ctx, func() {}
+	}
+}
+
+// finish 结束轮次：正在执行时交给下一个排队的轮次，登记或排队中时从列表移除。
+// 对已结束的轮次调用不产生影响。
+func (t *turnTracker) finish(id SessionID, tr *turn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tr.cancel != nil {
+		tr.cancel(nil)
+	}
+	st := t.sessions[id]
+	if st == nil {
+		return
+	}
+	if len(st.pending) > 0 && st.pending[0] == tr {
+		st.pending = st.pending[1:]
+		if len(st.pending) > 0 {
+			close(st.pending[0].head)
+		}
+	} else {
+		st.pending = removeTurn(st.pending, tr)
+	}
+	st.running = removeTurn(st.running, tr)
+	st.waiting = removeTurn(st.waiting, tr)
+	if len(st.running) == 0 && len(st.waiting) > 0 {
+		next := st.waiting[0]
+		st.waiting = st.waiting[1:]
+		st.running = append(st.running, next)
+		close(next.ready)
+	}
+	t.cleanup(id, st)
+}
+
+// cleanup 在会话没有任何轮次时移除其记录，调用方需持有 mu。
+func (t *turnTracker) cleanup(id SessionID, st *sessionTurns) {
+	if len(st.pending) == 0 && len(st.running) == 0 && len(st.waiting) == 0 {
+		delete(t.sessions, id)
+	}
+}
+
+// cancel 取消会话上已登记、进行中与排队中的轮次。
+func (t *turnTracker) cancel(id SessionID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if st := t.sessions[id]; st != nil {
+		st.cancelAll(ErrTurnCancelled)
+	}
+}
+
+// cancelAll 以 cause 取消所有会话上的轮次，用于连接关闭。
+func (t *turnTracker) cancelAll(cause error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, st := range t.sessions {
+		st.cancelAll(cause)
+	}
+}
+
+func (st *sessionTurns) cancelAll(cause error) {
+	for _, list := range [][]*turn{st.pending, st.running, st.waiting} {
+		for _, tr := range list {
+			tr.stop(cause)
+		}
+	}
+}
+
+func removeTurn(turns []*turn, tr *turn) []*turn {
+	for i, t := range turns {
+		if t == tr {
+			return append(turns[:i], turns[i+1:]...)
+		}
+	}
+	return turns
+}
+
+type reservedTurnContextKey struct{}
+
+// reservedTurn 是读循环为 session/prompt 登记的轮次。
+type reservedTurn struct {
+	id   SessionID
+	turn *turn
+}
+
+// reserveRequest 在读循环中为 session/prompt 登记轮次，使随后读到的 session/cancel
+// 一定能找到它，轮次也按到达顺序入场。策略要等请求通过检查、进入 prompt 后才应用，
+// 被拒绝的请求不会影响进行中的轮次。
+func (h *agentInboundHandler) reserveRequest(ctx context.Context, method string, params json.RawMessage) (context.Context, func()) {
+	if method != AgentMethods.SessionPrompt {
+		return ctx, func() {}
+	}
+	var req struct {
+		SessionID SessionID `json:"sessionId"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil {
+		return ctx, func() {}
+	}
+	tr := h.turns.record(req.SessionID)
+	ctx = context.WithValue(ctx, reservedTurnContextKey{}, reservedTurn{id: req.SessionID, turn: tr})
+	// 请求在到达 prompt 之前失败时释放登记的轮次。
+	return ctx, func() { h.turns.finish(req.SessionID, tr) }
+}
+
+// enterTurn 开始会话 id 的轮次，优先使用读循环中登记的轮次。
+func (h *agentInboundHandler) enterTurn(ctx context.Context, id SessionID) (context.Context, func(), error) {
+	if r, ok := ctx.Value(reservedTurnContextKey{}).(reservedTurn); ok && r.id == id {
+		if err := h.turns.admit(ctx, id, r.turn, h.opts.turnPolicy); err != nil {
+			return nil, nil, err
+		}
+		turnCtx, done := h.turns.wait(ctx, id, r.turn)
+		return turnCtx, done, nil
+	}
+	return h.turns.begin(ctx, id, h.opts.turnPolicy)
+}
+
+// prompt 在按会话可取消的 ctx 中调用 session/prompt 的处理器，已注册的斜杠命令交给 Commands。
+// 轮次被 session/cancel 取消后，无论处理器返回什么都响应 StopReasonCancelled。
+func (h *agentInboundHandler) prompt(ctx context.Context, req PromptRequest, next func(context.Context, PromptRequest) (PromptResponse, error)) (PromptResponse, error) {
+	turnCtx, done, err := h.enterTurn(ctx, req.SessionID)
+	if err != nil {
+		return PromptResponse{}, err
+	}
+	defer done()
+	defer h.idle.begin(req.SessionID)()
+	if turnCtx.Err() != nil {
+		// 排队期间已被取消，不再执行。
+		if IsTurnCancelled(turnCtx) {
+			return PromptResponse{StopReason: StopReasonCancelled}, nil
+		}
+		return PromptResponse{}, context.Cause(turnCtx)
+	}
+	resp, err := h.dispatchCommand(turnCtx, req, next)
+	if IsTurnCancelled(turnCtx) {
+		return PromptResponse{StopReason: StopReasonCancelled, Meta: resp.Meta}, nil
+	}
+	return resp, err
+}
+
+// dispatchCommand 将已注册的斜杠命令交给 Commands，其余 prompt 交给 next。
+func (h *agentInboundHandler) dispatchCommand(ctx context.Context, req PromptRequest, next func(context.Context, PromptRequest) (PromptResponse, error)) (PromptResponse, error) {
+	if h.opts.commands != nil {
+		if resp, ok, err := h.opts.commands.Dispatch(ctx, req); ok {
+			return resp, err
+		}
+	}
+	return next(ctx, req)
+}
+
+// cancel 先取消会话上进行中的轮次，再调用 session/cancel 的处理器。
+func (h *agentInboundHandler) cancel(ctx context.Context, note CancelNotification, next func(context.Context) error) error {
+	h.turns.cancel(note.SessionID)
+	h.idle.touchKnown(note.SessionID)
+	return next(ctx)
+}
+
+func connectionClosedError(err error) error {
+	if err == nil {
+		return fmt.Errorf("connection closed")
+	}
+	return fmt.Errorf("connection closed: %w", err)
+}
@@ -0,0 +1,323 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCancelInterruptsPromptTurn(t *testing.T) {
+	started := make(chan SessionID, 2)
+	agent := &mockAgent{cancelCh: make(chan CancelNotification, 1)}
+	agent.promptFunc = func(ctx context.Context, req PromptRequest) (PromptResponse, error) {
+		started <- req.SessionID
+		select {
+		case <-ctx.Done():
+			return PromptResponse{}, ctx.Err()
+		case <-time.After(time.Second):
+			return PromptResponse{StopReason: StopReasonEndTurn}, nil
+		}
+	}
+	_, clientConn := connectPair(t, agent, &mockClient{}, nil)
+	ctx := context.Background()
+
+	type result struct {
+		resp PromptResponse
+		err  error
+	}
+	prompt := func(id SessionID) chan result {
+		ch := make(chan result, 1)
+		go func() {
+			resp, err := clientConn.Prompt(ctx, PromptRequest{SessionID: id, Prompt: []ContentBlock{NewTextContentBlock("hi")}})
+			ch <- result{resp, err}
+		}()
+		return ch
+	}
+	cancelled := prompt("a")
+	other := prompt("b")
+	<-started
+	<-started
+
+	if err := clientConn.Cancel(ctx, CancelNotification{SessionID: "a"}); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+
+	select {
+	case res := <-cancelled:
+		if res.err != nil || res.resp.StopReason != StopReasonCancelled {
+			t.Fatalf("expected cancelled stop reason, got %+v (%v)", res.resp, res.err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("cancel did not interrupt the running turn")
+	}
+	select {
+	case note := <-agent.cancelCh:
+		if note.SessionID != "a" {
+			t.Fatalf("unexpected cancel notification %+v", note)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("agent Cancel was not called")
+	}
+
+	res := <-other
+	if res.err != nil || res.resp.StopReason != StopReasonEndTurn {
+		t.Fatalf("turn on other session should not be cancelled, got %+v (%v)", res.resp, res.err)
+	}
+}
+
+func TestTurnTrackerCause(t *testing.T) {
+	var tracker turnTracker
+	ctx, done, err := tracker.begin(context.Background(), "s", TurnPolicyReject)
+	if err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+	tracker.cancel("s")
+	if !IsTurnCancelled(ctx) {
+		t.Fatalf("expected turn to be cancelled by session/cancel")
+	}
+	done()
+
+	ctx, done, _ = tracker.begin(context.Background(), "s", TurnPolicyReject)
+	defer done()
+	closeErr := errors.New("eof")
+	tracker.cancelAll(connectionClosedError(closeErr))
+	if IsTurnCancelled(ctx) || !errors.Is(context.Cause(ctx), closeErr) {
+		t.Fatalf("unexpected cause %v", context.Cause(ctx))
+	}
+	if len(tracker.sessions) != 1 {
+		t.Fatalf("expected active turn to stay registered until done")
+	}
+}
+
+// blockingPromptAgent 的每个轮次都会阻塞，直到 release 被关闭或轮次被取消。
+func blockingPromptAgent(started chan<- string, release <-chan struct{}) *mockAgent {
+	agent := &mockAgent{cancelCh: make(chan CancelNotification, 4)}
+	agent.promptFunc = func(ctx context.Context, req PromptRequest) (PromptResponse, error) {
+		started <- req.Prompt[0].Text
+		select {
+		case <-ctx.Done():
+			return PromptResponse{}, ctx.Err()
+		case <-release:
+			return PromptResponse{StopReason: StopReasonEndTurn}, nil
+		}
+	}
+	return agent
+}
+
+type promptResult struct {
+	resp PromptResponse
+	err  error
+}
+
+func promptAsync(conn *ClientSideConnection, id SessionID, text string) <-chan promptResult {
+	ch := make(chan promptResult, 1)
+	go func() {
+		resp, err := conn.Prompt(context.Background(), PromptRequest{SessionID: id, Prompt: []ContentBlock{NewTextContentBlock(text)}})
+		ch <- promptResult{resp, err}
+	}()
+	return ch
+}
+
+func TestTurnPolicyAllowsOverlapWhenOptedIn(t *testing.T) {
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	_, clientConn := connectPair(t, blockingPromptAgent(started, release), &mockClient{}, []ConnectionOption{WithTurnPolicy(TurnPolicyAllow)})
+
+	first := promptAsync(clientConn, "s", "first")
+	second := promptAsync(clientConn, "s", "second")
+	<-started
+	<-started
+	close(release)
+	for _, ch := range []<-chan promptResult{first, second} {
+		if res := <-ch; res.err != nil || res.resp.StopReason != StopReasonEndTurn {
+			t.Fatalf("unexpected result %+v (%v)", res.resp, res.err)
+		}
+	}
+}
+
+func TestTurnPolicyRejectsOverlappingPromptByDefault(t *testing.T) {
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	_, clientConn := connectPair(t, blockingPromptAgent(started, release), &mockClient{}, nil)
+
+	first := promptAsync(clientConn, "s", "first")
+	<-started
+	second := <-promptAsync(clientConn, "s", "second")
+	if !errors.Is(second.err, ErrTurnInProgress) {
+		t.Fatalf("expected ErrTurnInProgress, got %v", second.err)
+	}
+	close(release)
+	if res := <-first; res.err != nil || res.resp.StopReason != StopReasonEndTurn {
+		t.Fatalf("first turn should complete, got %+v (%v)", res.resp, res.err)
+	}
+}
+
+func TestTurnPolicyQueuesOverlappingPrompt(t *testing.T) {
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	_, clientConn := connectPair(t, blockingPromptAgent(started, release), &mockClient{}, []ConnectionOption{WithTurnPolicy(TurnPolicyQueue)})
+
+	first := promptAsync(clientConn, "s", "first")
+	if got := <-started; got != "first" {
+		t.Fatalf("unexpected first turn %q", got)
+	}
+	second := promptAsync(clientConn, "s", "second")
+	select {
+	case got := <-started:
+		t.Fatalf("queued turn %q started while another turn was active", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if got := <-started; got != "second" {
+		t.Fatalf("unexpected queued turn %q", got)
+	}
+	for _, ch := range []<-chan promptResult{first, second} {
+		if res := <-ch; res.err != nil || res.resp.StopReason != StopReasonEndTurn {
+			t.Fatalf("unexpected result %+v (%v)", res.resp, res.err)
+		}
+	}
+}
+
+func TestTurnPolicyCancelsPreviousPrompt(t *testing.T) {
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	_, clientConn := connectPair(t, blockingPromptAgent(started, release), &mockClient{}, []ConnectionOption{WithTurnPolicy(TurnPolicyCancelPrevious)})
+
+	first := promptAsync(clientConn, "s", "first")
+	<-started
+	second := promptAsync(clientConn, "s", "second")
+	if res := <-first; res.err != nil || res.resp.StopReason != StopReasonCancelled {
+		t.Fatalf("previous turn should be cancelled, got %+v (%v)", res.resp, res.err)
+	}
+	if got := <-started; got != "second" {
+		t.Fatalf("unexpected turn %q", got)
+	}
+	close(release)
+	if res := <-second; res.err != nil || res.resp.StopReason != StopReasonEndTurn {
+		t.Fatalf("new turn should complete, got %+v (%v)", res.resp, res.err)
+	}
+}
+
+func TestCancelRightAfterPrompt(t *testing.T) {
+	agent := &mockAgent{cancelCh: make(chan CancelNotification, 1)}
+	agent.promptFunc = func(ctx context.Context, req PromptRequest) (PromptResponse, error) {
+		select {
+		case <-ctx.Done():
+			return PromptResponse{}, ctx.Err()
+		case <-time.After(2 * time.Second):
+			return PromptResponse{StopReason: StopReasonEndTurn}, nil
+		}
+	}
+	_, peer := newRawPeerAgent(t, agent)
+
+	// 两条消息一次写出，cancel 可能在 prompt 的处理器开始执行之前就被读到。
+	peer.write(`{"jsonrpc":"2.0","id":1,"method":"session/prompt","params":{"sessionId":"s","prompt":[{"type":"text","text":"hi"}]}}` + "\n" +
+		`{"jsonrpc":"2.0","method":"session/cancel","params":{"sessionId":"s"}}`)
+
+	resp := peer.read()
+	if resp.Error != nil || resp.Result == nil {
+		t.Fatalf("unexpected prompt response %+v", resp)
+	}
+	var result PromptResponse
+	if err := json.Unmarshal(*resp.Result, &result); err != nil {
+		t.Fatalf("decode prompt response: %v", err)
+	}
+	if result.StopReason != StopReasonCancelled {
+		t.Fatalf("expected cancelled stop reason, got %q", result.StopReason)
+	}
+}
+
+func TestTurnPolicyQueueKeepsArrivalOrder(t *testing.T) {
+	started := make(chan string, 3)
+	release := make(chan struct{})
+	_, peer := newRawPeerAgent(t, blockingPromptAgent(started, release), WithTurnPolicy(TurnPolicyQueue))
+
+	prompt := func(id int, text string) string {
+		return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"session/prompt","params":{"sessionId":"s","prompt":[{"type":"text","text":%q}]}}`, id, text)
+	}
+	peer.write(prompt(1, "first") + "\n" + prompt(2, "second") + "\n" + prompt(3, "third"))
+	if got := <-started; got != "first" {
+		t.Fatalf("unexpected first turn %q", got)
+	}
+	close(release)
+	for _, want := range []string{"second", "third"} {
+		if got := <-started; got != want {
+			t.Fatalf("queued turn %q ran before %q", got, want)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if resp := peer.read(); resp.Error != nil {
+			t.Fatalf("unexpected error %+v", resp.Error)
+		}
+	}
+}
+
+func TestQueuedTurnCancelledWhileWaiting(t *testing.T) {
+	var tracker turnTracker
+	_, doneFirst, _ := tracker.begin(context.Background(), "s", TurnPolicyQueue)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan func(), 1)
+	go func() {
+		turnCtx, done, _ := tracker.begin(ctx, "s", TurnPolicyQueue)
+		if turnCtx.Err() == nil {
+			t.Errorf("queued turn should end with its ctx")
+		}
+		result <- done
+	}()
+	for {
+		tracker.mu.Lock()
+		n := len(tracker.sessions["s"].waiting)
+		tracker.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	done := <-result
+
+	// 已结束的排队轮次再调用 done 不能影响正在执行的轮次。
+	done()
+	tracker.mu.Lock()
+	running := len(tracker.sessions["s"].running)
+	tracker.mu.Unlock()
+	if running != 1 {
+		t.Fatalf("expected the first turn to keep running, got %d running", running)
+	}
+	doneFirst()
+	if len(tracker.sessions) != 0 {
+		t.Fatalf("expected tracker to be empty, got %+v", tracker.sessions)
+	}
+}
+
+func TestRejectedPromptDoesNotCancelRunningTurn(t *testing.T) {
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	_, peer := newRawPeerAgent(t, blockingPromptAgent(started, release), WithTurnPolicy(TurnPolicyCancelPrevious), WithStrictDecoding())
+
+	peer.write(`{"jsonrpc":"2.0","id":1,"method":"session/prompt","params":{"sessionId":"s","prompt":[{"type":"text","text":"first"}]}}`)
+	<-started
+	// 第二个 prompt 含未知字段，严格解码失败后不应取消进行中的轮次。
+	peer.write(`{"jsonrpc":"2.0","id":2,"method":"session/prompt","params":{"sessionId":"s","prompt":[],"bogus":true}}`)
+	resp := peer.read()
+	if resp.Error == nil || resp.Error.Code != -32602 {
+		t.Fatalf("expected invalid params for the second prompt, got %+v", resp)
+	}
+
+	close(release)
+	resp = peer.read()
+	if resp.Error != nil || resp.Result == nil {
+		t.Fatalf("unexpected first prompt response %+v", resp)
+	}
+	var result PromptResponse
+	if err := json.Unmarshal(*resp.Result, &result); err != nil {
+		t.Fatalf("decode prompt response: %v", err)
+	}
+	if result.StopReason != StopReasonEndTurn {
+		t.Fatalf("running turn should not be cancelled, got %q", result.StopReason)
+	}
+}
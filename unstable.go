@@ -0,0 +1,152 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// 本文件中的方法与类型对应 ACP 草案中的不稳定接口，随时可能变化。
+// 只有在连接选项中启用 WithUnstableMethods 后才会被收发。
+
+// UnstableAgentMethodNames 定义客户端发送的不稳定 Agent 侧方法名。
+type UnstableAgentMethodNames struct {
+	SessionList            string
+	SessionSetConfigOption string
+}
+
+// 不稳定方法名常量。
+var (
+	UnstableAgentMethods = UnstableAgentMethodNames{
+		SessionList:            "session/list",
+		SessionSetConfigOption: "session/set_config_option",
+	}
+)
+
+// ListSessionsRequest 对应 session/list 请求。
+type ListSessionsRequest struct {
+	CWD    *string         `json:"cwd,omitempty"`
+	Cursor *string         `json:"cursor,omitempty"`
+	Meta   json.RawMessage `json:"_meta,omitempty"`
+}
+
+// SessionInfo 描述一个可加载的会话。
+type SessionInfo struct {
+	SessionID SessionID       `json:"sessionId"`
+	CWD       string          `json:"cwd"`
+	Title     *string         `json:"title,omitempty"`
+	UpdatedAt *string         `json:"updatedAt,omitempty"`
+	Meta      json.RawMessage `json:"_meta,omitempty"`
+}
+
+// ListSessionsResponse 对应 session/list 响应。
+type ListSessionsResponse struct {
+	Sessions   []SessionInfo   `json:"sessions"`
+	NextCursor *string         `json:"nextCursor,omitempty"`
+	Meta       json.RawMessage `json:"_meta,omitempty"`
+}
+
+// SessionConfigID 配置项标识。
+type SessionConfigID string
+
+// SessionConfigValueID 配置项取值标识。
+type SessionConfigValueID string
+
+// SessionConfigSelectOption 描述配置项的一个候选值。
+type SessionConfigSelectOption struct {
+	Value       SessionConfigValueID `json:"value"`
+	Name        string               `json:"name"`
+	Description *string              `json:"description,omitempty"`
+	Meta        json.RawMessage      `json:"_meta,omitempty"`
+}
+
+// SessionConfigOption 描述一个会话配置项。
+type SessionConfigOption struct {
+	ID           SessionConfigID             `json:"id"`
+	Name         string                      `json:"name"`
+	Description  *string                     `json:"description,omitempty"`
+	Type         string                      `json:"type"`
+	CurrentValue SessionConfigValueID        `json:"currentValue"`
+	Options      []SessionConfigSelectOption `json:"options"`
+	Meta         json.RawMessage             `json:"_meta,omitempty"`
+}
+
+// SetSessionConfigOptionRequest 对应 session/set_config_option 请求。
+type SetSessionConfigOptionRequest struct {
+	SessionID SessionID            `json:"sessionId"`
+	ConfigID  SessionConfigID      `json:"configId"`
+	Value     SessionConfigValueID `json:"value"`
+	Meta      json.RawMessage      `json:"_meta,omitempty"`
+}
+
+// SetSessionConfigOptionResponse 对应 session/set_config_option 响应。
+type SetSessionConfigOptionResponse struct {
+	ConfigOptions []SessionConfigOption `json:"configOptions"`
+	Meta          json.RawMessage       `json:"_meta,omitempty"`
+}
+
+// AgentSessionLister 为可选接口，实现后可处理 session/list。
+type AgentSessionLister interface {
+	ListSessions(context.Context, ListSessionsRequest) (ListSessionsResponse, error)
+}
+
+// AgentSessionConfigurator 为可选接口，实现后可处理 session/set_config_option。
+type AgentSessionConfigurator interface {
+	SetSessionConfigOption(context.Context, SetSessionConfigOptionRequest) (SetSessionConfigOptionResponse, error)
+}
+
+// WithUnstableMethods 启用不稳定方法的收发。
+func WithUnstableMethods() ConnectionOption {
+	return func(o *connectionOptions) {
+		o.unstable = true
+	}
+}
+
+// registerUnstableAgentMethods 为实现了可选接口的 Agent 注册不稳定方法。
+func registerUnstableAgentMethods(r *Router, agent Agent) {
+	if lister, ok := agent.(AgentSessionLister); ok {
+		Handle(r, UnstableAgentMethods.SessionList, lister.ListSessions)
+	}
+	if configurator, ok := agent.(AgentSessionConfigurator); ok {
+		Handle(r, UnstableAgentMethods.SessionSetConfigOption, configurator.SetSessionConfigOption)
+	}
+}
+
+func (c *ClientSideConnection) requireUnstable(method string) error {
+	if !c.opts.unstable {
+		return fmt.Errorf("acp: unstable method %s is not enabled", method)
+	}
+	return nil
+}
+
+// ListSessions 调用不稳定方法 session/list。
+func (c *ClientSideConnection) ListSessions(ctx context.Context, req ListSessionsRequest) (ListSessionsResponse, error) {
+	var resp ListSessionsResponse
+	if err := c.requireUnstable(UnstableAgentMethods.SessionList); err != nil {
+		return resp, err
+	}
+	raw, err := c.rpc.request(ctx, UnstableAgentMethods.SessionList, req)
+	if err != nil {
+		return resp, err
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// SetSessionConfigOption 调用不稳定方法 session/set_config_option。
+func (c *ClientSideConnection) SetSessionConfigOption(ctx context.Context, req SetSessionConfigOptionRequest) (SetSessionConfigOptionResponse, error) {
+	var resp SetSessionConfigOptionResponse
+	if err := c.requireUnstable(UnstableAgentMethods.SessionSetConfigOption); err != nil {
+		return resp, err
+	}
+	raw, err := c.rpc.request(ctx, UnstableAgentMethods.SessionSetConfigOption, req)
+	if err != nil {
+		return resp, err
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
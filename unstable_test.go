@@ -0,0 +1,55 @@
+package acp
+
+import (
+	"context"
+	"testing"
+)
+
+type listingAgent struct {
+	UnimplementedAgent
+}
+
+func (listingAgent) ListSessions(context.Context, ListSessionsRequest) (ListSessionsResponse, error) {
+	return ListSessionsResponse{
+		Sessions: []SessionInfo{{SessionID: "sess-1", CWD: "/tmp"}},
+	}, nil
+}
+
+func TestUnstableMethodsDisabledByDefault(t *testing.T) {
+	handler := &agentInboundHandler{agent: listingAgent{}}
+	_, errObj, _ := handler.handleRequest(context.Background(), UnstableAgentMethods.SessionList, mustRawJSON(ListSessionsRequest{}))
+	if errObj.Code != ErrorCodeMethodNotFound.Code {
+		t.Fatalf("expected method not found, got %+v", errObj)
+	}
+}
+
+func TestUnstableSessionList(t *testing.T) {
+	handler := &agentInboundHandler{
+		agent: listingAgent{},
+		opts:  newConnectionOptions([]ConnectionOption{WithUnstableMethods()}),
+	}
+	resp, errObj, _ := handler.handleRequest(context.Background(), UnstableAgentMethods.SessionList, mustRawJSON(ListSessionsRequest{}))
+	if errObj.Code != 0 {
+		t.Fatalf("unexpected error: %+v", errObj)
+	}
+	result, ok := resp.(ListSessionsResponse)
+	if !ok || len(result.Sessions) != 1 || result.Sessions[0].SessionID != "sess-1" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+
+	_, errObj, _ = handler.handleRequest(context.Background(), UnstableAgentMethods.SessionSetConfigOption, mustRawJSON(SetSessionConfigOptionRequest{
+		SessionID: "sess-1",
+		ConfigID:  "model",
+		Value:     "fast",
+	}))
+	if errObj.Code != ErrorCodeMethodNotFound.Code {
+		t.Fatalf("expected method not found for unimplemented optional interface, got %+v", errObj)
+	}
+}
+
+func TestClientUnstableMethodsRequireOption(t *testing.T) {
+	conn := &ClientSideConnection{}
+	if _, err := conn.ListSessions(context.Background(), ListSessionsRequest{}); err == nil {
+		t.Fatalf("expected error when unstable methods are disabled")
+	}
+}
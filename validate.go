@@ -0,0 +1,325 @@
+package acp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ValidationError 描述请求中不合法的字段，Pointer 为 RFC 6901 JSON Pointer。
+type ValidationError struct {
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+// Error 实现 error 接口。
+func (e *ValidationError) Error() string {
+	if e.Pointer == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Pointer, e.Message)
+}
+
+// validator 由支持 Validate 的请求类型实现。
+type validator interface {
+	Validate() error
+}
+
+func fieldError(pointer, format string, args ...any) error {
+	return &ValidationError{Pointer: pointer, Message: fmt.Sprintf(format, args...)}
+}
+
+// jsonPointer 拼接 JSON Pointer，并转义 ~ 与 /。
+func jsonPointer(base string, tokens ...any) string {
+	var b strings.Builder
+	b.WriteString(base)
+	for _, token := range tokens {
+		b.WriteByte('/')
+		switch v := token.(type) {
+		case int:
+			b.WriteString(strconv.Itoa(v))
+		default:
+			s := fmt.Sprint(v)
+			s = strings.ReplaceAll(s, "~", "~0")
+			s = strings.ReplaceAll(s, "/", "~1")
+			b.WriteString(s)
+		}
+	}
+	return b.String()
+}
+
+// isAbsolutePath 判断路径是否为绝对路径，同时接受 Unix 与 Windows 形式。
+func isAbsolutePath(p string) bool {
+	switch {
+	case strings.HasPrefix(p, "/"), strings.HasPrefix(p, `\\`):
+		return true
+	case len(p) >= 3 && p[1] == ':' && (p[2] == '\\' || p[2] == '/'):
+		c := p[0] | 0x20
+		return c >= 'a' && c <= 'z'
+	default:
+		return false
+	}
+}
+
+func requireNonEmpty(pointer, value string) error {
+	if value == "" {
+		return fieldError(pointer, "must not be empty")
+	}
+	return nil
+}
+
+func requireAbsolutePath(pointer, value string) error {
+	if value == "" {
+		return fieldError(pointer, "must not be empty")
+	}
+	if !isAbsolutePath(value) {
+		return fieldError(pointer, "must be an absolute path")
+	}
+	return nil
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateMcpServers(servers []McpServer) error {
+	for i, server := range servers {
+		if err := server.Validate(); err != nil {
+			return fieldError(jsonPointer("/mcpServers", i), "%s", err.Error())
+		}
+	}
+	return nil
+}
+
+func validateEnv(base string, env []EnvVariable) error {
+	for i, v := range env {
+		if v.Name == "" {
+			return fieldError(jsonPointer(base, i, "name"), "must not be empty")
+		}
+	}
+	return nil
+}
+
+// Validate 校验 initialize 请求。
+func (r InitializeRequest) Validate() error {
+	if r.ClientInfo != nil {
+		return requireNonEmpty("/clientInfo/name", r.ClientInfo.Name)
+	}
+	return nil
+}
+
+// Validate 校验 authenticate 请求。
+func (r AuthenticateRequest) Validate() error {
+	return requireNonEmpty("/methodId", string(r.MethodID))
+}
+
+// Validate 校验 session/new 请求。
+func (r NewSessionRequest) Validate() error {
+	return firstError(
+		requireAbsolutePath("/cwd", r.CWD),
+		validateMcpServers(r.McpServers),
+	)
+}
+
+// Validate 校验 session/load 请求。
+func (r LoadSessionRequest) Validate() error {
+	return firstError(
+		requireNonEmpty("/sessionId", string(r.SessionID)),
+		requireAbsolutePath("/cwd", r.CWD),
+		validateMcpServers(r.McpServers),
+	)
+}
+
+// Validate 校验 session/set_mode 请求。
+func (r SetSessionModeRequest) Validate() error {
+	return firstError(
+		requireNonEmpty("/sessionId", string(r.SessionID)),
+		requireNonEmpty("/modeId", string(r.ModeID)),
+	)
+}
+
+// Validate 校验 session/set_model 请求。
+func (r SetSessionModelRequest) Validate() error {
+	return firstError(
+		requireNonEmpty("/sessionId", string(r.SessionID)),
+		requireNonEmpty("/modelId", string(r.ModelID)),
+	)
+}
+
+// Validate 校验 session/prompt 请求。
+func (r PromptRequest) Validate() error {
+	if err := requireNonEmpty("/sessionId", string(r.SessionID)); err != nil {
+		return err
+	}
+	if len(r.Prompt) == 0 {
+		return fieldError("/prompt", "must not be empty")
+	}
+	for i, block := range r.Prompt {
+		if err := block.validate(jsonPointer("/prompt", i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate 校验 session/cancel 通知。
+func (r CancelNotification) Validate() error {
+	return requireNonEmpty("/sessionId", string(r.SessionID))
+}
+
+func (b ContentBlock) validate(base string) error {
+	switch b.Type {
+	case ContentBlockTypeText:
+		return nil
+	case ContentBlockTypeImage, ContentBlockTypeAudio:
+		return firstError(
+			requireNonEmpty(base+"/data", b.Data),
+			requireNonEmpty(base+"/mimeType", b.MimeType),
+		)
+	case ContentBlockTypeResourceLink:
+		return firstError(
+			requireNonEmpty(base+"/uri", b.URI),
+			requireNonEmpty(base+"/name", b.Name),
+		)
+	case ContentBlockTypeResource:
+		return nil
+	default:
+		return fieldError(base+"/type", "unknown content block type %q", b.Type)
+	}
+}
+
+// Validate 校验 session/update 通知。
+func (n SessionNotification) Validate() error {
+	if err := requireNonEmpty("/sessionId", string(n.SessionID)); err != nil {
+		return err
+	}
+	switch n.Update.Type {
+	case SessionUpdateTypeAgentMessageChunk,
+		SessionUpdateTypeUserMessageChunk,
+		SessionUpdateTypeAgentThoughtChunk,
+		SessionUpdateTypeToolCall,
+		SessionUpdateTypeToolCallUpdate,
+		SessionUpdateTypePlan,
+		SessionUpdateTypeAvailableCommands,
+		SessionUpdateTypeCurrentMode:
+	default:
+		return fieldError("/update/sessionUpdate", "unknown session update type %q", n.Update.Type)
+	}
+	if n.Update.Content != nil {
+		return n.Update.Content.validate("/update/content")
+	}
+	return nil
+}
+
+// Validate 校验 session/request_permission 请求。
+func (r RequestPermissionRequest) Validate() error {
+	if err := firstError(
+		requireNonEmpty("/sessionId", string(r.SessionID)),
+		requireNonEmpty("/toolCall/id", r.ToolCall.ID),
+	); err != nil {
+		return err
+	}
+	if len(r.Options) == 0 {
+		return fieldError("/options", "must not be empty")
+	}
+	for i, option := range r.Options {
+		if err := requireNonEmpty(jsonPointer("/options", i, "optionId"), string(option.ID)); err != nil {
+			return err
+		}
+		switch option.Kind {
+		case PermissionOptionKindAllowOnce,
+			PermissionOptionKindAllowAlways,
+			PermissionOptionKindRejectOnce,
+			PermissionOptionKindRejectAlways:
+		default:
+			return fieldError(jsonPointer("/options", i, "kind"), "unknown permission option kind %q", option.Kind)
+		}
+	}
+	return nil
+}
+
+// Validate 校验 fs/write_text_file 请求。
+func (r WriteTextFileRequest) Validate() error {
+	return firstError(
+		requireNonEmpty("/sessionId", string(r.SessionID)),
+		requireAbsolutePath("/path", r.Path),
+	)
+}
+
+// Validate 校验 fs/read_text_file 请求。
+func (r ReadTextFileRequest) Validate() error {
+	if err := firstError(
+		requireNonEmpty("/sessionId", string(r.SessionID)),
+		requireAbsolutePath("/path", r.Path),
+	); err != nil {
+		return err
+	}
+	if r.Line != nil && *r.Line == 0 {
+		return fieldError("/line", "must be at least 1")
+	}
+	return nil
+}
+
+// Validate 校验 terminal/create 请求。
+func (r CreateTerminalRequest) Validate() error {
+	if err := firstError(
+		requireNonEmpty("/sessionId", string(r.SessionID)),
+		requireNonEmpty("/command", r.Command),
+		validateEnv("/env", r.Env),
+	); err != nil {
+		return err
+	}
+	if r.CWD != "" && !isAbsolutePath(r.CWD) {
+		return fieldError("/cwd", "must be an absolute path")
+	}
+	return nil
+}
+
+func validateTerminalRef(sessionID SessionID, terminalID TerminalID) error {
+	return firstError(
+		requireNonEmpty("/sessionId", string(sessionID)),
+		requireNonEmpty("/terminalId", string(terminalID)),
+	)
+}
+
+// Validate 校验 terminal/output 请求。
+func (r TerminalOutputRequest) Validate() error {
+	return validateTerminalRef(r.SessionID, r.TerminalID)
+}
+
+// Validate 校验 terminal/release 请求。
+func (r ReleaseTerminalRequest) Validate() error {
+	return validateTerminalRef(r.SessionID, r.TerminalID)
+}
+
+// Validate 校验 terminal/wait_for_exit 请求。
+func (r WaitForTerminalExitRequest) Validate() error {
+	return validateTerminalRef(r.SessionID, r.TerminalID)
+}
+
+// Validate 校验 terminal/kill 请求。
+func (r KillTerminalCommandRequest) Validate() error {
+	return validateTerminalRef(r.SessionID, r.TerminalID)
+}
+
+// Validate 校验 session/list 请求。
+func (r ListSessionsRequest) Validate() error {
+	if r.CWD != nil && !isAbsolutePath(*r.CWD) {
+		return fieldError("/cwd", "must be an absolute path")
+	}
+	return nil
+}
+
+// Validate 校验 session/set_config_option 请求。
+func (r SetSessionConfigOptionRequest) Validate() error {
+	return firstError(
+		requireNonEmpty("/sessionId", string(r.SessionID)),
+		requireNonEmpty("/configId", string(r.ConfigID)),
+		requireNonEmpty("/value", string(r.Value)),
+	)
+}
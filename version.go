@@ -6,27 +6,36 @@ import (
 )
 
 // ProtocolVersion 表示 ACP 协议版本号。
+//
+// 零值 ProtocolVersion{} 表示未指定版本，与 ProtocolVersionV0 不同；
+// 版本只能通过常量、NewProtocolVersion 或 JSON 解码得到。
 type ProtocolVersion struct {
 	value uint16
+	set   bool
 }
 
 // 常用版本常量。
 var (
-	ProtocolVersionV0      = ProtocolVersion{value: 0}
-	ProtocolVersionV1      = ProtocolVersion{value: 1}
+	ProtocolVersionV0      = ProtocolVersion{value: 0, set: true}
+	ProtocolVersionV1      = ProtocolVersion{value: 1, set: true}
 	ProtocolVersionCurrent = ProtocolVersionV1
 )
 
 // NewProtocolVersion 构造指定版本。
 func NewProtocolVersion(v uint16) ProtocolVersion {
-	return ProtocolVersion{value: v}
+	return ProtocolVersion{value: v, set: true}
 }
 
-// Value 返回版本号。
+// Value 返回版本号，未指定时为 0。
 func (v ProtocolVersion) Value() uint16 {
 	return v.value
 }
 
+// IsSet 判断版本是否被指定，用于区分零值与 ProtocolVersionV0。
+func (v ProtocolVersion) IsSet() bool {
+	return v.set
+}
+
 // MarshalJSON 实现 json.Marshaler。
 func (v ProtocolVersion) MarshalJSON() ([]byte, error) {
 	return json.Marshal(v.value)
@@ -46,7 +55,63 @@ func (v *ProtocolVersion) UnmarshalJSON(data []byte) error {
 		if err := json.Unmarshal(data, &val); err != nil {
 			return fmt.Errorf("protocol version: %w", err)
 		}
-		*v = ProtocolVersion{value: val}
+		*v = ProtocolVersion{value: val, set: true}
 		return nil
 	}
 }
+
+// supportedProtocolVersions 为 SDK 默认支持的协议版本，通过 WithProtocolVersions 覆盖。
+var supportedProtocolVersions = []ProtocolVersion{ProtocolVersionV1}
+
+// SupportedProtocolVersions 返回 SDK 默认支持的协议版本。
+func SupportedProtocolVersions() []ProtocolVersion {
+	return append([]ProtocolVersion(nil), supportedProtocolVersions...)
+}
+
+// ErrUnsupportedProtocolVersion 表示对端选择了本端无法使用的协议版本。
+type ErrUnsupportedProtocolVersion struct {
+	Version   ProtocolVersion
+	Supported []ProtocolVersion
+}
+
+// Error 实现 error 接口。
+func (e *ErrUnsupportedProtocolVersion) Error() string {
+	values := make([]uint16, 0, len(e.Supported))
+	for _, v := range e.Supported {
+		values = append(values, v.value)
+	}
+	return fmt.Sprintf("acp: unsupported protocol version %d (supported: %v)", e.Version.value, values)
+}
+
+// NegotiateProtocolVersion 选择不高于 requested 的最高受支持版本。
+//
+// 若不存在这样的版本，则按 ACP 约定返回本端支持的最高版本，由对端决定是否断开。
+func NegotiateProtocolVersion(requested ProtocolVersion, supported []ProtocolVersion) ProtocolVersion {
+	if len(supported) == 0 {
+		supported = supportedProtocolVersions
+	}
+	var best, highest *ProtocolVersion
+	for i := range supported {
+		v := &supported[i]
+		if highest == nil || v.value > highest.value {
+			highest = v
+		}
+		if v.value <= requested.value && (best == nil || v.value > best.value) {
+			best = v
+		}
+	}
+	if best != nil {
+		return *best
+	}
+	return *highest
+}
+
+// supportsProtocolVersion 判断版本是否在支持列表中。
+func supportsProtocolVersion(version ProtocolVersion, supported []ProtocolVersion) bool {
+	for _, v := range supported {
+		if v.value == version.value {
+			return true
+		}
+	}
+	return false
+}
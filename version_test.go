@@ -1,6 +1,7 @@
 package acp
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 )
@@ -42,3 +43,83 @@ func TestProtocolVersionUnmarshalTooLarge(t *testing.T) {
 		t.Fatalf("expected error for value > uint16, got nil")
 	}
 }
+
+func TestNegotiateProtocolVersion(t *testing.T) {
+	supported := []ProtocolVersion{ProtocolVersionV0, ProtocolVersionV1}
+	if got := NegotiateProtocolVersion(NewProtocolVersion(3), supported); got.Value() != 1 {
+		t.Fatalf("expected highest common version 1, got %d", got.Value())
+	}
+	if got := NegotiateProtocolVersion(ProtocolVersionV0, supported); got.Value() != 0 {
+		t.Fatalf("expected version 0, got %d", got.Value())
+	}
+	if got := NegotiateProtocolVersion(ProtocolVersionV0, []ProtocolVersion{ProtocolVersionV1}); got.Value() != 1 {
+		t.Fatalf("expected fallback to latest supported version, got %d", got.Value())
+	}
+}
+
+func TestAgentCanPinProtocolVersion(t *testing.T) {
+	agent := &mockAgent{initializeFunc: func(context.Context, InitializeRequest) (InitializeResponse, error) {
+		return InitializeResponse{ProtocolVersion: ProtocolVersionV1}, nil
+	}}
+	handler := &agentInboundHandler{agent: agent, opts: newConnectionOptions([]ConnectionOption{
+		WithProtocolVersions(ProtocolVersionV1, NewProtocolVersion(2)),
+	})}
+	resp, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.Initialize, mustRawJSON(InitializeRequest{
+		ProtocolVersion: NewProtocolVersion(2),
+	}))
+	if errObj.Code != 0 {
+		t.Fatalf("unexpected error: %+v", errObj)
+	}
+	if got := resp.(InitializeResponse).ProtocolVersion.Value(); got != 1 {
+		t.Fatalf("agent-selected version was overwritten with %d", got)
+	}
+}
+
+func TestSupportedProtocolVersionsIsCopy(t *testing.T) {
+	versions := SupportedProtocolVersions()
+	versions[0] = NewProtocolVersion(99)
+	if SupportedProtocolVersions()[0].Value() == 99 {
+		t.Fatal("SupportedProtocolVersions exposed the package default")
+	}
+}
+
+func TestAgentCanPinProtocolVersionV0(t *testing.T) {
+	agent := &mockAgent{initializeFunc: func(context.Context, InitializeRequest) (InitializeResponse, error) {
+		return InitializeResponse{ProtocolVersion: ProtocolVersionV0}, nil
+	}}
+	handler := &agentInboundHandler{agent: agent, opts: newConnectionOptions([]ConnectionOption{
+		WithProtocolVersions(ProtocolVersionV0, ProtocolVersionV1),
+	})}
+	resp, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.Initialize, mustRawJSON(InitializeRequest{
+		ProtocolVersion: ProtocolVersionV1,
+	}))
+	if errObj.Code != 0 {
+		t.Fatalf("unexpected error: %+v", errObj)
+	}
+	if got := resp.(InitializeResponse).ProtocolVersion; !got.IsSet() || got.Value() != 0 {
+		t.Fatalf("agent-selected version 0 was overwritten with %d", got.Value())
+	}
+}
+
+func TestAgentSelectedUnsupportedProtocolVersion(t *testing.T) {
+	agent := &mockAgent{initializeFunc: func(context.Context, InitializeRequest) (InitializeResponse, error) {
+		return InitializeResponse{ProtocolVersion: NewProtocolVersion(7)}, nil
+	}}
+	handler := &agentInboundHandler{agent: agent}
+	_, errObj, _ := handler.handleRequest(context.Background(), AgentMethods.Initialize, mustRawJSON(InitializeRequest{
+		ProtocolVersion: ProtocolVersionV1,
+	}))
+	if errObj.Code != ErrorCodeInternalError.Code {
+		t.Fatalf("expected internal error for unsupported agent version, got %+v", errObj)
+	}
+}
+
+func TestProtocolVersionZeroValueIsUnset(t *testing.T) {
+	if (ProtocolVersion{}).IsSet() || !ProtocolVersionV0.IsSet() {
+		t.Fatal("zero value must be distinguishable from ProtocolVersionV0")
+	}
+	var v ProtocolVersion
+	if err := json.Unmarshal([]byte("0"), &v); err != nil || !v.IsSet() {
+		t.Fatalf("decoded version 0 should be set, got %+v (%v)", v, err)
+	}
+}